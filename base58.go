@@ -0,0 +1,96 @@
+package go_mcminterface
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/sigurn/crc16"
+)
+
+// ErrInvalidEncoding is wrapped by the errors of ParseTag and
+// ParseWotsAddressHex, along with the error telling what is wrong with the
+// input
+var ErrInvalidEncoding = errors.New("invalid encoding")
+
+var (
+	ErrInvalidCharacter = errors.New("invalid character")
+	ErrInvalidLength    = errors.New("wrong length")
+	ErrBadChecksum      = errors.New("checksum mismatch")
+)
+
+// BASE58_ALPHABET is the bitcoin alphabet, without 0, O, I and l
+const BASE58_ALPHABET = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// base58Check encodes data followed by its crc16 (XMODEM, little endian)
+func base58Check(data []byte) string {
+	table := crc16.MakeTable(crc16.CRC16_XMODEM)
+	sum := crc16.Checksum(data, table)
+	payload := append(append([]byte{}, data...), byte(sum&0xff), byte(sum>>8))
+
+	n := new(big.Int).SetBytes(payload)
+	radix := big.NewInt(58)
+	mod := new(big.Int)
+	var out []byte
+	for n.Sign() > 0 {
+		n.DivMod(n, radix, mod)
+		out = append(out, BASE58_ALPHABET[mod.Int64()])
+	}
+	// each leading zero byte is a leading 1
+	for _, b := range payload {
+		if b != 0 {
+			break
+		}
+		out = append(out, BASE58_ALPHABET[0])
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
+
+// parseBase58Check decodes a base58Check string of length bytes of data
+func parseBase58Check(s string, length int) ([]byte, error) {
+	if s == "" {
+		return nil, fmt.Errorf("%w: %w: empty string", ErrInvalidEncoding, ErrInvalidLength)
+	}
+	n := new(big.Int)
+	radix := big.NewInt(58)
+	zeros := 0
+	for i, c := range s {
+		digit := strings.IndexRune(BASE58_ALPHABET, c)
+		if digit < 0 {
+			return nil, fmt.Errorf("%w: %w %q at position %d", ErrInvalidEncoding, ErrInvalidCharacter, c, i)
+		}
+		if digit == 0 && zeros == i {
+			zeros++
+		}
+		n.Mul(n, radix)
+		n.Add(n, big.NewInt(int64(digit)))
+	}
+	payload := append(make([]byte, zeros), n.Bytes()...)
+	if len(payload) != length+2 {
+		return nil, fmt.Errorf("%w: %w: decodes to %d bytes, expected %d", ErrInvalidEncoding, ErrInvalidLength, len(payload)-2, length)
+	}
+
+	data := payload[:length]
+	table := crc16.MakeTable(crc16.CRC16_XMODEM)
+	sum := crc16.Checksum(data, table)
+	if payload[length] != byte(sum&0xff) || payload[length+1] != byte(sum>>8) {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidEncoding, ErrBadChecksum)
+	}
+	return data, nil
+}
+
+// TagString encodes a 12 bytes tag in base58 with a crc16 checksum.
+// Only tags are encoded this way: a whole address would take about 3000
+// characters. Addresses are exchanged as hex, or by their tag.
+func TagString(tag []byte) string {
+	return base58Check(tag)
+}
+
+// ParseTag decodes a tag encoded by TagString
+func ParseTag(s string) ([]byte, error) {
+	return parseBase58Check(s, TXTAGLEN)
+}
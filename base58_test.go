@@ -0,0 +1,125 @@
+package go_mcminterface_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	mcm "github.com/NickP005/go_mcminterface"
+)
+
+var testTags = [][]byte{
+	[]byte("wallet tag.."),
+	make([]byte, mcm.TXTAGLEN),
+	{0, 0, 0, 1, 2, 3, 4, 5, 6, 7, 8, 9},
+	bytes.Repeat([]byte{0xff}, mcm.TXTAGLEN),
+}
+
+func TestTagRoundTrip(t *testing.T) {
+	for _, tag := range testTags {
+		s := mcm.TagString(tag)
+		parsed, err := mcm.ParseTag(s)
+		if err != nil {
+			t.Errorf("%x: %v", tag, err)
+			continue
+		}
+		if !bytes.Equal(parsed, tag) {
+			t.Errorf("%x: round trip gave %x", tag, parsed)
+		}
+	}
+	// leading zero bytes are leading 1s
+	if s := mcm.TagString(testTags[1]); !strings.HasPrefix(s, strings.Repeat("1", mcm.TXTAGLEN)) {
+		t.Errorf("zero tag encoded as %s", s)
+	}
+}
+
+func TestParseTagTypos(t *testing.T) {
+	for _, tag := range testTags {
+		s := mcm.TagString(tag)
+		// every single character replaced by the next one of the alphabet
+		for i := range s {
+			next := mcm.BASE58_ALPHABET[(strings.IndexByte(mcm.BASE58_ALPHABET, s[i])+1)%len(mcm.BASE58_ALPHABET)]
+			typo := s[:i] + string(next) + s[i+1:]
+			if _, err := mcm.ParseTag(typo); !errors.Is(err, mcm.ErrBadChecksum) && !errors.Is(err, mcm.ErrInvalidLength) {
+				t.Errorf("%s: typo at %d: err = %v", s, i, err)
+			}
+		}
+		// two characters swapped
+		for i := 0; i+1 < len(s); i++ {
+			if s[i] == s[i+1] {
+				continue
+			}
+			swap := s[:i] + string(s[i+1]) + string(s[i]) + s[i+2:]
+			if _, err := mcm.ParseTag(swap); !errors.Is(err, mcm.ErrBadChecksum) && !errors.Is(err, mcm.ErrInvalidLength) {
+				t.Errorf("%s: swap at %d: err = %v", s, i, err)
+			}
+		}
+	}
+}
+
+func TestParseTagErrors(t *testing.T) {
+	valid := mcm.TagString(testTags[0])
+	tests := []struct {
+		name  string
+		input string
+		want  error
+	}{
+		{"empty", "", mcm.ErrInvalidLength},
+		{"zero", "0" + valid[1:], mcm.ErrInvalidCharacter},
+		{"capital o", valid[:3] + "O" + valid[4:], mcm.ErrInvalidCharacter},
+		{"lower l", valid[:5] + "l" + valid[6:], mcm.ErrInvalidCharacter},
+		{"space", valid + " ", mcm.ErrInvalidCharacter},
+		{"short tag", mcm.TagString(testTags[0][:11]), mcm.ErrInvalidLength},
+		{"long tag", mcm.TagString(append([]byte("wallet tag.."), 'x')), mcm.ErrInvalidLength},
+		{"extra leading 1", "1" + valid, mcm.ErrInvalidLength},
+		{"last character", valid[:len(valid)-1] + lastNeighbour(valid), mcm.ErrBadChecksum},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := mcm.ParseTag(tt.input)
+			if !errors.Is(err, tt.want) || !errors.Is(err, mcm.ErrInvalidEncoding) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// lastNeighbour returns a character next to the last one of s in the
+// alphabet: the decoded number is off by one, which only touches the checksum
+func lastNeighbour(s string) string {
+	digit := strings.IndexByte(mcm.BASE58_ALPHABET, s[len(s)-1])
+	if digit == len(mcm.BASE58_ALPHABET)-1 {
+		return string(mcm.BASE58_ALPHABET[digit-1])
+	}
+	return string(mcm.BASE58_ALPHABET[digit+1])
+}
+
+func TestParseWotsAddressHex(t *testing.T) {
+	address := mcm.NewWotsKeypair([]byte("address")).Address()
+	s := hex.EncodeToString(address.Address[:])
+	parsed, err := mcm.ParseWotsAddressHex(s)
+	if err != nil || parsed.Address != address.Address {
+		t.Fatalf("round trip: err = %v", err)
+	}
+	tests := []struct {
+		name  string
+		input string
+		want  error
+	}{
+		{"empty", "", mcm.ErrInvalidLength},
+		{"short", s[:len(s)-2], mcm.ErrInvalidLength},
+		{"long", s + "00", mcm.ErrInvalidLength},
+		{"odd", s[:len(s)-1], mcm.ErrInvalidCharacter},
+		{"not hex", "zz" + s[2:], mcm.ErrInvalidCharacter},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := mcm.ParseWotsAddressHex(tt.input)
+			if !errors.Is(err, tt.want) || !errors.Is(err, mcm.ErrInvalidEncoding) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -2,14 +2,24 @@ package go_mcminterface
 
 import (
 	"encoding/binary"
+	"fmt"
 )
 
 type Block struct {
 	Header  BHEADER
 	Body    []TXQENTRY
+	Ledger  []WotsAddress // neo-genesis blocks only, sorted by address
 	Trailer BTRAILER
 }
 
+// Kinds of block, see BlockType
+const (
+	BLOCK_NORMAL     = iota // mined, with transactions
+	BLOCK_PSEUDO            // no transactions, a header length and a trailer
+	BLOCK_NEOGENESIS        // every 256 blocks, the ledger in place of the header
+	BLOCK_INVALID
+)
+
 type BHEADER struct {
 	Hdrlen  uint32
 	Maddr   [TXADDRLEN]byte
@@ -93,25 +103,91 @@ func bTrailerFromBytes(bytes []byte) BTRAILER {
 	return trailer
 }
 
-// convert bytes to a block
-func BlockFromBytes(bytes []byte) Block {
-	var block Block
+// BlockType tells the kind of block from its bytes: a header length of 2220
+// is a normal block, 4 with nothing else but the trailer a pseudo-block, and
+// 4 plus whole ledger entries on a multiple of 256 a neo-genesis block.
+func BlockType(bytes []byte) int {
+	if len(bytes) < 4+BTRAILER_LEN {
+		return BLOCK_INVALID
+	}
+	hdrlen := binary.LittleEndian.Uint32(bytes[0:4])
+	if uint64(hdrlen) > uint64(len(bytes)-BTRAILER_LEN) {
+		return BLOCK_INVALID
+	}
+	bnum := binary.LittleEndian.Uint64(bytes[len(bytes)-BTRAILER_LEN+32:])
+	// a ledger of a single entry has the header length of a normal block
+	switch {
+	case bnum&0xff == 0:
+		if hdrlen >= 4 && (hdrlen-4)%LENTRY_LEN == 0 && int(hdrlen)+BTRAILER_LEN == len(bytes) {
+			return BLOCK_NEOGENESIS
+		}
+	case hdrlen == 2220 && (len(bytes)-2220-BTRAILER_LEN)%8824 == 0:
+		return BLOCK_NORMAL
+	case hdrlen == 4 && len(bytes) == 4+BTRAILER_LEN:
+		return BLOCK_PSEUDO
+	}
+	return BLOCK_INVALID
+}
 
+// ParseBlock decodes a block of any kind, failing on malformed bytes
+func ParseBlock(bytes []byte) (Block, error) {
+	var block Block
+	kind := BlockType(bytes)
+	if kind == BLOCK_INVALID {
+		return block, fmt.Errorf("malformed block of %d bytes", len(bytes))
+	}
 	block.Header = bHeaderFromBytes(bytes)
-	block.Body = bBodyFromBytes(bytes[block.Header.Hdrlen : len(bytes)-160])
 	block.Trailer = bTrailerFromBytes(bytes[len(bytes)-160:])
+	switch kind {
+	case BLOCK_NORMAL:
+		block.Body = bBodyFromBytes(bytes[block.Header.Hdrlen : len(bytes)-160])
+	case BLOCK_NEOGENESIS:
+		block.Header = BHEADER{Hdrlen: block.Header.Hdrlen}
+		ledger, err := LedgerFromBytes(bytes[4:block.Header.Hdrlen])
+		if err != nil {
+			return Block{}, err
+		}
+		block.Ledger = ledger.Entries()
+	}
+	return block, nil
+}
 
+// convert bytes to a block, malformed bytes give an empty block
+func BlockFromBytes(bytes []byte) Block {
+	block, _ := ParseBlock(bytes)
 	return block
 }
 
+// Type tells the kind of block
+func (bd *Block) Type() int {
+	switch {
+	case binary.LittleEndian.Uint64(bd.Trailer.Bnum[:])&0xff == 0:
+		return BLOCK_NEOGENESIS
+	case bd.Header.Hdrlen == 2220:
+		return BLOCK_NORMAL
+	case bd.Header.Hdrlen == 4:
+		return BLOCK_PSEUDO
+	}
+	return BLOCK_INVALID
+}
+
 // convert a block to bytes
 func (bd *Block) GetBytes() []byte {
 	var bytes []byte
 
-	bytes = append(bytes, bd.Header.GetBytes()...)
+	if bd.Type() == BLOCK_NEOGENESIS {
+		bytes = binary.LittleEndian.AppendUint32(bytes, bd.Header.Hdrlen)
+	} else {
+		bytes = append(bytes, bd.Header.GetBytes()...)
+	}
 	for _, tx := range bd.Body {
 		bytes = append(bytes, tx.GetBytes()...)
 	}
+	// the ledger of a neo-genesis block is its header
+	for i := range bd.Ledger {
+		bytes = append(bytes, bd.Ledger[i].Address[:]...)
+		bytes = append(bytes, bd.Ledger[i].GetAmountBytes()...)
+	}
 	bytes = append(bytes, bd.Trailer.GetBytes()...)
 
 	return bytes
@@ -125,6 +201,10 @@ func (bh *BHEADER) GetBytes() []byte {
 	hdrlen := make([]byte, 4)
 	binary.LittleEndian.PutUint32(hdrlen, bh.Hdrlen)
 	bytes = append(bytes, hdrlen...)
+	// pseudo-blocks have a header length only
+	if bh.Hdrlen != 2220 {
+		return bytes
+	}
 	bytes = append(bytes, bh.Maddr[:]...)
 	mreward := make([]byte, 8)
 	binary.LittleEndian.PutUint64(mreward, bh.Mreward)
@@ -0,0 +1,90 @@
+package go_mcminterface_test
+
+import (
+	"encoding/binary"
+	"testing"
+
+	mcm "github.com/NickP005/go_mcminterface"
+	"github.com/NickP005/go_mcminterface/mcmtest"
+)
+
+func TestParseBlock(t *testing.T) {
+	chain := v2Chain(t)
+	chain.AddPseudoBlock()
+	chain.SetBalance(mcm.NewWotsKeypair([]byte("other")).Address(), 1)
+	chain.AddNeoGenesis()
+	// a single entry ledger has the header length of a normal block
+	single := mcmtest.NewChain()
+	single.SetBalance(mcm.NewWotsKeypair([]byte("single")).Address(), 1)
+	single.AddNeoGenesis()
+
+	block := func(c *mcmtest.Chain, bnum uint64) []byte {
+		bytes, _ := c.BlockBytes(bnum)
+		return append([]byte{}, bytes...)
+	}
+	normal := block(chain, 1)
+	pseudo := block(chain, 2)
+	with_hdrlen := func(bytes []byte, hdrlen uint32) []byte {
+		bytes = append([]byte{}, bytes...)
+		binary.LittleEndian.PutUint32(bytes, hdrlen)
+		return bytes
+	}
+	cut := func(bytes []byte, n int) []byte {
+		// drop n bytes before the trailer
+		end := len(bytes) - mcm.BTRAILER_LEN
+		return append(append([]byte{}, bytes[:end-n]...), bytes[end:]...)
+	}
+
+	tests := []struct {
+		name    string
+		bytes   []byte
+		kind    int
+		body    int
+		entries int
+	}{
+		{"genesis", block(chain, 0), mcm.BLOCK_NEOGENESIS, 0, 0},
+		{"normal", normal, mcm.BLOCK_NORMAL, 1, 0},
+		{"pseudo", pseudo, mcm.BLOCK_PSEUDO, 0, 0},
+		{"neo-genesis", block(chain, 256), mcm.BLOCK_NEOGENESIS, 0, 3},
+		{"single entry neo-genesis", block(single, 256), mcm.BLOCK_NEOGENESIS, 0, 1},
+		{"empty", nil, mcm.BLOCK_INVALID, 0, 0},
+		{"trailer only", normal[len(normal)-mcm.BTRAILER_LEN:], mcm.BLOCK_INVALID, 0, 0},
+		{"truncated header", normal[:4+mcm.BTRAILER_LEN], mcm.BLOCK_INVALID, 0, 0},
+		{"truncated transaction", cut(normal, 1), mcm.BLOCK_INVALID, 0, 0},
+		{"truncated ledger entry", cut(block(chain, 256), 1), mcm.BLOCK_INVALID, 0, 0},
+		{"header length past the end", with_hdrlen(pseudo, 5), mcm.BLOCK_INVALID, 0, 0},
+		{"wrong header length", with_hdrlen(normal, 2224), mcm.BLOCK_INVALID, 0, 0},
+		{"pseudo-block with a header length of 2220", with_hdrlen(pseudo, 2220), mcm.BLOCK_INVALID, 0, 0},
+		{"neo-genesis with a wrong header length", with_hdrlen(block(chain, 256), 4+mcm.LENTRY_LEN), mcm.BLOCK_INVALID, 0, 0},
+		{"pseudo-block with a body", append(append([]byte{}, pseudo[:4]...), normal[2220:]...), mcm.BLOCK_INVALID, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if kind := mcm.BlockType(tt.bytes); kind != tt.kind {
+				t.Fatalf("BlockType = %d, want %d", kind, tt.kind)
+			}
+			parsed, err := mcm.ParseBlock(tt.bytes)
+			if tt.kind == mcm.BLOCK_INVALID {
+				if err == nil {
+					t.Error("malformed block parsed")
+				}
+				if empty := mcm.BlockFromBytes(tt.bytes); empty.Header.Hdrlen != 0 || empty.Body != nil {
+					t.Error("BlockFromBytes of a malformed block is not empty")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if parsed.Type() != tt.kind || len(parsed.Body) != tt.body || len(parsed.Ledger) != tt.entries {
+				t.Errorf("parsed kind %d with %d transactions and %d ledger entries", parsed.Type(), len(parsed.Body), len(parsed.Ledger))
+			}
+			if string(parsed.GetBytes()) != string(tt.bytes) {
+				t.Error("GetBytes does not give back the block bytes")
+			}
+			if err := parsed.Verify(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
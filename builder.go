@@ -0,0 +1,141 @@
+package go_mcminterface
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// MFEE is the minimum transaction fee, in nanoMCM
+const MFEE = 500
+
+// TransactionBuilder builds a signed Transaction spending the whole balance
+// of a WOTS+ source address: Amount goes to the destination, Fee to the
+// miner and the rest to the change address.
+type TransactionBuilder struct {
+	Source    WotsKeypair
+	SourceTag []byte // tag of the source address, the default tag if nil
+	Balance   uint64 // balance of the source address, queried if zero
+
+	Destination    WotsAddress
+	DestinationTag []byte // if set, resolved to the Destination
+
+	Change WotsAddress // must carry the tag of a tagged source
+	Amount uint64
+	Fee    uint64 // MFEE if zero
+
+	Client *Client // used for the queries, DefaultClient if nil
+}
+
+// SignedMessage returns the message signed by Tx_sig: the sha256 of the
+// transaction from Src_addr to Tx_fee
+func (tx *Transaction) SignedMessage() [HASHLEN]byte {
+	bytes := tx.Bytes()
+	return sha256.Sum256(bytes[:3*TXADDRLEN+3*TXAMOUNT])
+}
+
+// Build validates the transaction, signs it and returns it ready for
+// SubmitTransaction
+func (b *TransactionBuilder) Build() (Transaction, error) {
+	return b.BuildContext(context.Background())
+}
+
+// BuildContext is Build giving up the queries when ctx is done
+func (b *TransactionBuilder) BuildContext(ctx context.Context) (Transaction, error) {
+	c := b.Client
+	if c == nil {
+		c = DefaultClient
+	}
+	source := b.Source.Address()
+	if b.SourceTag != nil {
+		if len(b.SourceTag) != TXTAGLEN {
+			return Transaction{}, fmt.Errorf("source tag must be %d bytes", TXTAGLEN)
+		}
+		source.SetTAG(b.SourceTag)
+	}
+
+	destination := b.Destination
+	if b.DestinationTag != nil {
+		resolved, err := c.QueryTagResolveContext(ctx, b.DestinationTag)
+		if err != nil {
+			return Transaction{}, fmt.Errorf("resolving destination tag: %w", err)
+		}
+		destination = resolved
+	}
+	if destination.Address == [TXADDRLEN]byte{} {
+		return Transaction{}, fmt.Errorf("no destination address")
+	}
+	if destination.Address == source.Address {
+		return Transaction{}, fmt.Errorf("destination is the source address")
+	}
+
+	// a WOTS+ address signs once, the change must go elsewhere
+	change := b.Change
+	if bytes.Equal(change.Address[:WOTS_PK_LEN], source.Address[:WOTS_PK_LEN]) {
+		return Transaction{}, fmt.Errorf("change address is the source address")
+	}
+	// the tag of the source follows the change
+	if !source.IsDefaultTag() && !bytes.Equal(change.GetTAG(), source.GetTAG()) {
+		return Transaction{}, fmt.Errorf("change address must carry the tag of the source")
+	}
+
+	fee := b.Fee
+	if fee == 0 {
+		fee = MFEE
+	}
+	if fee < MFEE {
+		return Transaction{}, fmt.Errorf("fee %d below the minimum %d", fee, MFEE)
+	}
+
+	balance := b.Balance
+	if balance == 0 {
+		var err error
+		balance, err = c.QueryBalanceContext(ctx, hex.EncodeToString(source.Address[:]))
+		if err != nil {
+			return Transaction{}, fmt.Errorf("querying source balance: %w", err)
+		}
+	}
+	if b.Amount > balance || fee > balance-b.Amount {
+		return Transaction{}, fmt.Errorf("balance %d is lower than amount %d plus fee %d", balance, b.Amount, fee)
+	}
+	change_total := balance - b.Amount - fee
+	// a tag lives only on an address holding funds
+	if change_total == 0 && !source.IsDefaultTag() {
+		return Transaction{}, fmt.Errorf("no change left to keep the source tag")
+	}
+	// the change would be burned
+	if change_total > 0 && change.Address == [TXADDRLEN]byte{} {
+		return Transaction{}, fmt.Errorf("no change address for the %d left", change_total)
+	}
+	// a tag on the change of an untagged source is created by the
+	// transaction, no other address may hold it
+	if change_total > 0 && source.IsDefaultTag() && !change.IsDefaultTag() {
+		_, err := c.QueryTagResolveContext(ctx, change.GetTAG())
+		if err == nil {
+			return Transaction{}, fmt.Errorf("change tag %x is already in use", change.GetTAG())
+		}
+		if !errors.Is(err, ErrTagNotFound) {
+			return Transaction{}, fmt.Errorf("resolving change tag: %w", err)
+		}
+	}
+
+	var tx Transaction
+	tx.Src_addr = source.Address
+	tx.Dst_addr = destination.Address
+	tx.Chg_addr = change.Address
+	binary.LittleEndian.PutUint64(tx.Send_total[:], b.Amount)
+	binary.LittleEndian.PutUint64(tx.Change_total[:], change_total)
+	binary.LittleEndian.PutUint64(tx.Tx_fee[:], fee)
+
+	msg := tx.SignedMessage()
+	sig, err := b.Source.Sign(msg[:])
+	if err != nil {
+		return Transaction{}, err
+	}
+	tx.Tx_sig = sig
+	return tx, nil
+}
@@ -0,0 +1,76 @@
+package go_mcminterface_test
+
+import (
+	"strings"
+	"testing"
+
+	mcm "github.com/NickP005/go_mcminterface"
+	"github.com/NickP005/go_mcminterface/mcmtest"
+)
+
+func TestBuilderChange(t *testing.T) {
+	chain := mcmtest.NewChain()
+	taken := mcm.NewWotsKeypair([]byte("taken")).Address()
+	taken.SetTAG([]byte("tag in use.."))
+	chain.SetBalance(taken, 1000)
+
+	client := mcmtest.NewTestNetwork(t, chain, chain, chain).Client(3)
+
+	builder := mcm.TransactionBuilder{
+		Source:      mcm.NewWotsKeypair([]byte("source")),
+		Balance:     100000,
+		Destination: mcm.NewWotsKeypair([]byte("destination")).Address(),
+		Amount:      1000,
+		Client:      client,
+	}
+	// the change would go to an empty address
+	if _, err := builder.Build(); err == nil || !strings.Contains(err.Error(), "no change address") {
+		t.Errorf("missing change: err = %v", err)
+	}
+
+	builder.Change = mcm.NewWotsKeypair([]byte("change")).Address()
+	builder.Change.SetTAG(taken.GetTAG())
+	if _, err := builder.Build(); err == nil || !strings.Contains(err.Error(), "already in use") {
+		t.Errorf("tag in use: err = %v", err)
+	}
+
+	builder.Change.SetTAG([]byte("new tag....."))
+	if _, err := builder.Build(); err != nil {
+		t.Errorf("new tag: %v", err)
+	}
+}
+
+func TestBuilderRejects(t *testing.T) {
+	valid := func() mcm.TransactionBuilder {
+		return mcm.TransactionBuilder{
+			Source:      mcm.NewWotsKeypair([]byte("source")),
+			Balance:     10000,
+			Destination: mcm.NewWotsKeypair([]byte("destination")).Address(),
+			Change:      mcm.NewWotsKeypair([]byte("change")).Address(),
+			Amount:      1000,
+		}
+	}
+	builder := valid()
+	if _, err := builder.Build(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(b *mcm.TransactionBuilder)
+		reason string
+	}{
+		{"insufficient balance", func(b *mcm.TransactionBuilder) { b.Amount = 9600 }, "balance 10000 is lower than amount 9600 plus fee 500"},
+		{"amount above balance", func(b *mcm.TransactionBuilder) { b.Amount = 20000 }, "is lower than amount 20000"},
+		{"fee below MFEE", func(b *mcm.TransactionBuilder) { b.Fee = 100 }, "fee 100 below the minimum 500"},
+		{"change is the source", func(b *mcm.TransactionBuilder) { b.Change = b.Source.Address() }, "change address is the source"},
+		{"no destination", func(b *mcm.TransactionBuilder) { b.Destination = mcm.WotsAddress{} }, "no destination"},
+	}
+	for _, test := range tests {
+		builder := valid()
+		test.modify(&builder)
+		if _, err := builder.Build(); err == nil || !strings.Contains(err.Error(), test.reason) {
+			t.Errorf("%s: err = %v, want %q", test.name, err, test.reason)
+		}
+	}
+}
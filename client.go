@@ -0,0 +1,196 @@
+package go_mcminterface
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+)
+
+// Dialer opens the TCP connections to the nodes. *net.Dialer implements it.
+type Dialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// Client talks to one MCM network with its own node table, quorum size and
+// timeouts. Several clients can be used at the same time.
+type Client struct {
+	Settings     *SettingsType
+	Dialer       Dialer        // used to connect to nodes, net.Dialer if nil
+	ReadTimeout  time.Duration // per socket read, SOCK_READ_TIMEOUT if zero
+	WriteTimeout time.Duration // per socket write, SOCK_WRITE_TIMEOUT if zero
+	Logger       *slog.Logger  // silent if nil
+
+	// ValidateTrailers makes QueryBTrailers check the trailers it returns
+	// with ValidateTrailerChain
+	ValidateTrailers bool
+
+	nodes_mu sync.RWMutex // guards Settings.Nodes
+}
+
+// DefaultClient is the client behind the package-level functions. It works
+// on the global Settings, so LoadSettings affects it.
+var DefaultClient = &Client{Settings: &Settings}
+
+// NewClient creates a client working on its own copy of settings
+func NewClient(settings SettingsType) *Client {
+	return &Client{Settings: &settings}
+}
+
+// Expand known IPs of DefaultClient
+func ExpandIPs() {
+	DefaultClient.ExpandIPs()
+}
+
+// Benchmark the IPs of DefaultClient
+func BenchmarkNodes(n int) {
+	DefaultClient.BenchmarkNodes(n)
+}
+
+// Pick n random nodes from Settings.Nodes
+func PickNodes(n int) []RemoteNode {
+	return DefaultClient.PickNodes(n)
+}
+
+// Query the balance of an address given as hex
+func QueryBalance(wots_address string) (uint64, error) {
+	return DefaultClient.QueryBalance(wots_address)
+}
+
+// QueryBalanceContext is QueryBalance giving up when ctx is done
+func QueryBalanceContext(ctx context.Context, wots_address string) (uint64, error) {
+	return DefaultClient.QueryBalanceContext(ctx, wots_address)
+}
+
+// QueryBlockHash queries the block hash (HASHLEN) of a block number
+// if block number is 0, it returns the hash of the last block.
+func QueryBlockHash(block_num uint64) ([HASHLEN]byte, error) {
+	return DefaultClient.QueryBlockHash(block_num)
+}
+
+// QueryBlockHashContext is QueryBlockHash giving up when ctx is done
+func QueryBlockHashContext(ctx context.Context, block_num uint64) ([HASHLEN]byte, error) {
+	return DefaultClient.QueryBlockHashContext(ctx, block_num)
+}
+
+// QueryBlockBytes downloads a block whose hash reaches quorum
+func QueryBlockBytes(block_num uint64) ([]byte, error) {
+	return DefaultClient.QueryBlockBytes(block_num)
+}
+
+// QueryBlockBytesContext is QueryBlockBytes giving up when ctx is done
+func QueryBlockBytesContext(ctx context.Context, block_num uint64) ([]byte, error) {
+	return DefaultClient.QueryBlockBytesContext(ctx, block_num)
+}
+
+// QueryBlockFromNumber
+func QueryBlockFromNumber(block_num uint64) (Block, error) {
+	return DefaultClient.QueryBlockFromNumber(block_num)
+}
+
+// QueryBlockFromNumberContext is QueryBlockFromNumber giving up when ctx is done
+func QueryBlockFromNumberContext(ctx context.Context, block_num uint64) (Block, error) {
+	return DefaultClient.QueryBlockFromNumberContext(ctx, block_num)
+}
+
+// QueryGenesisBlock downloads the genesis block with DefaultClient
+func QueryGenesisBlock() (Block, error) {
+	return DefaultClient.QueryGenesisBlock()
+}
+
+// QueryGenesisBlockContext is QueryGenesisBlock giving up when ctx is done
+func QueryGenesisBlockContext(ctx context.Context) (Block, error) {
+	return DefaultClient.QueryGenesisBlockContext(ctx)
+}
+
+// QueryBlockV3FromNumber downloads a block in the v3 format
+func QueryBlockV3FromNumber(block_num uint64) (BlockV3, error) {
+	return DefaultClient.QueryBlockV3FromNumber(block_num)
+}
+
+// QueryBlockV3FromNumberContext is QueryBlockV3FromNumber giving up when ctx is done
+func QueryBlockV3FromNumberContext(ctx context.Context, block_num uint64) (BlockV3, error) {
+	return DefaultClient.QueryBlockV3FromNumberContext(ctx, block_num)
+}
+
+// SubmitTransactionV3 sends a v3 transaction with DefaultClient
+func SubmitTransactionV3(tx TransactionV3) error {
+	return DefaultClient.SubmitTransactionV3(tx)
+}
+
+// SubmitTransactionV3Context is SubmitTransactionV3 giving up when ctx is done
+func SubmitTransactionV3Context(ctx context.Context, tx TransactionV3) error {
+	return DefaultClient.SubmitTransactionV3Context(ctx, tx)
+}
+
+// QueryTagResolve queries the tag resolve
+func QueryTagResolve(tag []byte) (WotsAddress, error) {
+	return DefaultClient.QueryTagResolve(tag)
+}
+
+// QueryTagResolveContext is QueryTagResolve giving up when ctx is done
+func QueryTagResolveContext(ctx context.Context, tag []byte) (WotsAddress, error) {
+	return DefaultClient.QueryTagResolveContext(ctx, tag)
+}
+
+// QueryTagResolveHex
+func QueryTagResolveHex(tag_hex string) (WotsAddress, error) {
+	return DefaultClient.QueryTagResolveHex(tag_hex)
+}
+
+// QueryTagResolveHexContext is QueryTagResolveHex giving up when ctx is done
+func QueryTagResolveHexContext(ctx context.Context, tag_hex string) (WotsAddress, error) {
+	return DefaultClient.QueryTagResolveHexContext(ctx, tag_hex)
+}
+
+// QueryLatestBlockNumber
+func QueryLatestBlockNumber() (uint64, error) {
+	return DefaultClient.QueryLatestBlockNumber()
+}
+
+// QueryLatestBlockNumberContext is QueryLatestBlockNumber giving up when ctx is done
+func QueryLatestBlockNumberContext(ctx context.Context) (uint64, error) {
+	return DefaultClient.QueryLatestBlockNumberContext(ctx)
+}
+
+// QueryBTrailers queries `count` block trailers starting from `start_block`
+func QueryBTrailers(start_block uint32, count uint32) ([]BTRAILER, error) {
+	return DefaultClient.QueryBTrailers(start_block, count)
+}
+
+// QueryBTrailersContext is QueryBTrailers giving up when ctx is done
+func QueryBTrailersContext(ctx context.Context, start_block uint32, count uint32) ([]BTRAILER, error) {
+	return DefaultClient.QueryBTrailersContext(ctx, start_block, count)
+}
+
+// SubmitTransaction sends tx to QuerySize nodes
+func SubmitTransaction(tx Transaction) error {
+	return DefaultClient.SubmitTransaction(tx)
+}
+
+// SubmitTransactionContext is SubmitTransaction giving up when ctx is done
+func SubmitTransactionContext(ctx context.Context, tx Transaction) error {
+	return DefaultClient.SubmitTransactionContext(ctx, tx)
+}
+
+// QueryCandidateBlock downloads the candidate block of a random node
+func QueryCandidateBlock() (Block, error) {
+	return DefaultClient.QueryCandidateBlock()
+}
+
+// QueryCandidateBlockContext is QueryCandidateBlock giving up when ctx is done
+func QueryCandidateBlockContext(ctx context.Context) (Block, error) {
+	return DefaultClient.QueryCandidateBlockContext(ctx)
+}
+
+// SubmitMinedBlock sends a solved block to QuerySize nodes, reporting which
+// of them adopted it
+func SubmitMinedBlock(block Block) ([]BlockSubmission, error) {
+	return DefaultClient.SubmitMinedBlock(block)
+}
+
+// SubmitMinedBlockContext is SubmitMinedBlock giving up when ctx is done
+func SubmitMinedBlockContext(ctx context.Context, block Block) ([]BlockSubmission, error) {
+	return DefaultClient.SubmitMinedBlockContext(ctx, block)
+}
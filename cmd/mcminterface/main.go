@@ -0,0 +1,66 @@
+// Command mcminterface runs tools on top of go_mcminterface.
+//
+//	mcminterface serve [-addr :8080] [-settings settings.json] [-expand]
+//
+// serve exposes the block explorer JSON API of package explorer.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	mcm "github.com/NickP005/go_mcminterface"
+	"github.com/NickP005/go_mcminterface/explorer"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: mcminterface serve [-addr :8080] [-settings settings.json] [-expand]")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	switch os.Args[1] {
+	case "serve":
+		serve(os.Args[2:])
+	default:
+		usage()
+	}
+}
+
+func serve(args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := flags.String("addr", ":8080", "address to listen on")
+	settings_path := flags.String("settings", "", "settings file, the embedded defaults if empty")
+	expand := flags.Bool("expand", false, "expand and benchmark the node list before serving")
+	flags.Parse(args)
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	mcm.DefaultClient.Logger = logger
+	if *settings_path != "" {
+		mcm.LoadSettings(*settings_path)
+	} else {
+		mcm.LoadDefaultSettings()
+	}
+	if *expand {
+		mcm.ExpandIPs()
+		mcm.BenchmarkNodes(5)
+	}
+
+	server := &http.Server{
+		Addr:              *addr,
+		Handler:           explorer.NewServer(mcm.DefaultClient),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	logger.Info("serving explorer API", "addr", *addr)
+	if err := server.ListenAndServe(); err != nil {
+		logger.Error("server stopped", "error", err)
+		os.Exit(1)
+	}
+}
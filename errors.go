@@ -0,0 +1,113 @@
+package go_mcminterface
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNodeBusy is returned when a node answers OP_BUSY: the request is fine
+// but should be retried later, possibly on another node.
+var ErrNodeBusy = errors.New("node is busy")
+
+// ErrNodeRejected is returned when a node answers OP_NACK to a request
+var ErrNodeRejected = errors.New("node rejected the request")
+
+var (
+	ErrTagNotFound     = errors.New("tag not found")
+	ErrAddressNotFound = errors.New("address not found")
+	ErrChecksum        = errors.New("crc16 checksum failed")
+	ErrBadTrailer      = errors.New("trailer failed") // wrong TXTRAILER in a received TX
+	ErrNeoGenesis      = errors.New("neo-genesis block does not hold its whole ledger")
+	ErrBadPacket       = errors.New("file packet longer than SEND_FILE_LEN")
+	ErrProtocolVersion = errors.New("node does not speak the transaction format") // see PVERSION3
+)
+
+// ErrNoQuorum is returned when no answer is shared by QuerySize/2+1 nodes.
+// errors.Is(err, &ErrNoQuorum{}) matches any of them.
+type ErrNoQuorum struct {
+	What      string // what was queried, e.g. "balance"
+	Queried   int    // nodes asked
+	Responses int    // valid answers received
+	Votes     int    // votes of the most common answer
+	Needed    int    // votes needed to reach quorum
+}
+
+func (e *ErrNoQuorum) Error() string {
+	return fmt.Sprintf("no %s reaches quorum: best answer has %d of %d needed votes (%d answers from %d nodes)",
+		e.What, e.Votes, e.Needed, e.Responses, e.Queried)
+}
+
+func (e *ErrNoQuorum) Is(target error) bool {
+	_, ok := target.(*ErrNoQuorum)
+	return ok
+}
+
+// ErrUnexpectedOpcode is returned when a node answers with the wrong opcode.
+// OP_BUSY and OP_NACK are reported as ErrNodeBusy and ErrNodeRejected instead.
+type ErrUnexpectedOpcode struct {
+	Got  uint16
+	Want uint16
+}
+
+func (e *ErrUnexpectedOpcode) Error() string {
+	return fmt.Sprintf("opcode is not %s (got %s)", opName(e.Want), opName(e.Got))
+}
+
+func (e *ErrUnexpectedOpcode) Is(target error) bool {
+	_, ok := target.(*ErrUnexpectedOpcode)
+	return ok
+}
+
+// ErrConnect is returned when the connection or the handshake with a node
+// fails. Err is the cause, e.g. a net error or ErrNodeBusy.
+type ErrConnect struct {
+	IP  string
+	Err error
+}
+
+func (e *ErrConnect) Error() string {
+	return fmt.Sprintf("connection to %s failed: %v", e.IP, e.Err)
+}
+
+func (e *ErrConnect) Unwrap() error {
+	return e.Err
+}
+
+func (e *ErrConnect) Is(target error) bool {
+	_, ok := target.(*ErrConnect)
+	return ok
+}
+
+// ErrTrailerChain is returned when a list of trailers is not a valid chain.
+// Index is the position of the offending trailer in the list.
+type ErrTrailerChain struct {
+	Index  int
+	Block  uint64
+	Reason string
+}
+
+func (e *ErrTrailerChain) Error() string {
+	return fmt.Sprintf("trailer %d (block %d): %s", e.Index, e.Block, e.Reason)
+}
+
+func (e *ErrTrailerChain) Is(target error) bool {
+	_, ok := target.(*ErrTrailerChain)
+	return ok
+}
+
+// ErrBadTransaction is returned when a transaction of a block is invalid.
+// Index is its position in the block body.
+type ErrBadTransaction struct {
+	Block  uint64
+	Index  int
+	Reason string
+}
+
+func (e *ErrBadTransaction) Error() string {
+	return fmt.Sprintf("block %d, transaction %d: %s", e.Block, e.Index, e.Reason)
+}
+
+func (e *ErrBadTransaction) Is(target error) bool {
+	_, ok := target.(*ErrBadTransaction)
+	return ok
+}
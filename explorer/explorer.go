@@ -0,0 +1,219 @@
+// Package explorer serves a block explorer JSON API over HTTP, answering
+// from the MCM network through a go_mcminterface Client.
+package explorer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	mcm "github.com/NickP005/go_mcminterface"
+)
+
+// MAX_TRAILERS bounds the count of a /trailers request
+const MAX_TRAILERS = 1000
+
+// Server answers the API requests with Client
+type Server struct {
+	Client *mcm.Client
+	mux    *http.ServeMux
+}
+
+// NewServer creates the API server for client, DefaultClient if nil:
+//
+//	GET  /blocks/latest
+//	GET  /blocks/{n}       0 is the genesis block
+//	GET  /trailers?start=&count=
+//	GET  /balance/{addr}   address as hex
+//	GET  /tag/{tag}        tag as hex or base58
+//	GET  /nodes
+//	POST /tx               a transaction as JSON, see TXQENTRY
+func NewServer(client *mcm.Client) *Server {
+	if client == nil {
+		client = mcm.DefaultClient
+	}
+	s := &Server{Client: client, mux: http.NewServeMux()}
+	s.mux.HandleFunc("GET /blocks/latest", s.handleLatestBlock)
+	s.mux.HandleFunc("GET /blocks/{n}", s.handleBlock)
+	s.mux.HandleFunc("GET /trailers", s.handleTrailers)
+	s.mux.HandleFunc("GET /balance/{addr}", s.handleBalance)
+	s.mux.HandleFunc("GET /tag/{tag}", s.handleTag)
+	s.mux.HandleFunc("GET /nodes", s.handleNodes)
+	s.mux.HandleFunc("POST /tx", s.handleTx)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) handleLatestBlock(w http.ResponseWriter, r *http.Request) {
+	bnum, err := s.Client.QueryLatestBlockNumberContext(r.Context())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	s.writeBlock(w, r, bnum)
+}
+
+func (s *Server) handleBlock(w http.ResponseWriter, r *http.Request) {
+	bnum, err := strconv.ParseUint(r.PathValue("n"), 0, 64)
+	if err != nil {
+		writeError(w, badRequest("block number: %v", err))
+		return
+	}
+	// block 0 stands for the latest block in the queries, the genesis
+	// block has its own query
+	if bnum == 0 {
+		block, err := s.Client.QueryGenesisBlockContext(r.Context())
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, block)
+		return
+	}
+	s.writeBlock(w, r, bnum)
+}
+
+func (s *Server) writeBlock(w http.ResponseWriter, r *http.Request, bnum uint64) {
+	block, err := s.Client.QueryBlockFromNumberContext(r.Context(), bnum)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, block)
+}
+
+func (s *Server) handleTrailers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	start, err := strconv.ParseUint(query.Get("start"), 0, 32)
+	if err != nil {
+		writeError(w, badRequest("start: %v", err))
+		return
+	}
+	count := uint64(1)
+	if query.Has("count") {
+		count, err = strconv.ParseUint(query.Get("count"), 0, 32)
+		if err != nil {
+			writeError(w, badRequest("count: %v", err))
+			return
+		}
+	}
+	if count == 0 || count > MAX_TRAILERS {
+		writeError(w, badRequest("count must be between 1 and %d", MAX_TRAILERS))
+		return
+	}
+	trailers, err := s.Client.QueryBTrailersContext(r.Context(), uint32(start), uint32(count))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, trailers)
+}
+
+type balanceResponse struct {
+	Address string `json:"address"`
+	Tag     string `json:"tag"`
+	Balance uint64 `json:"balance"`
+}
+
+func (s *Server) handleBalance(w http.ResponseWriter, r *http.Request) {
+	address, err := mcm.ParseWotsAddressHex(r.PathValue("addr"))
+	if err != nil {
+		writeError(w, badRequest("address: %v", err))
+		return
+	}
+	balance, err := s.Client.QueryBalanceContext(r.Context(), hex.EncodeToString(address.Address[:]))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, balanceResponse{
+		Address: hex.EncodeToString(address.Address[:]),
+		Tag:     hex.EncodeToString(address.GetTAG()),
+		Balance: balance,
+	})
+}
+
+func (s *Server) handleTag(w http.ResponseWriter, r *http.Request) {
+	param := r.PathValue("tag")
+	tag, err := hex.DecodeString(param)
+	if err != nil || len(tag) != mcm.TXTAGLEN {
+		if tag, err = mcm.ParseTag(param); err != nil {
+			writeError(w, badRequest("tag: %v", err))
+			return
+		}
+	}
+	address, err := s.Client.QueryTagResolveContext(r.Context(), tag)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, balanceResponse{
+		Address: hex.EncodeToString(address.Address[:]),
+		Tag:     hex.EncodeToString(tag),
+		Balance: address.Amount,
+	})
+}
+
+func (s *Server) handleNodes(w http.ResponseWriter, r *http.Request) {
+	nodes := s.Client.Nodes()
+	if nodes == nil {
+		nodes = []mcm.RemoteNode{}
+	}
+	writeJSON(w, http.StatusOK, nodes)
+}
+
+func (s *Server) handleTx(w http.ResponseWriter, r *http.Request) {
+	var entry mcm.TXQENTRY
+	// a transaction in hex is about 18 KB
+	if err := json.NewDecoder(io.LimitReader(r.Body, 64<<10)).Decode(&entry); err != nil {
+		writeError(w, badRequest("transaction: %v", err))
+		return
+	}
+	if err := s.Client.SubmitTransactionContext(r.Context(), entry.Transaction()); err != nil {
+		writeError(w, err)
+		return
+	}
+	tx_id := sha256.Sum256(entry.Src_addr[:])
+	writeJSON(w, http.StatusAccepted, map[string]string{"tx_id": hex.EncodeToString(tx_id[:])})
+}
+
+// errBadRequest is an error of the request itself
+type errBadRequest struct {
+	msg string
+}
+
+func (e *errBadRequest) Error() string {
+	return e.msg
+}
+
+func badRequest(format string, args ...any) error {
+	return &errBadRequest{msg: fmt.Sprintf(format, args...)}
+}
+
+// writeError answers with the status matching err: 400 for bad requests,
+// 404 for unknown addresses and tags, 502 when the network fails to answer
+func writeError(w http.ResponseWriter, err error) {
+	var bad_request *errBadRequest
+	status := http.StatusBadGateway
+	switch {
+	case errors.As(err, &bad_request):
+		status = http.StatusBadRequest
+	case errors.Is(err, mcm.ErrAddressNotFound), errors.Is(err, mcm.ErrTagNotFound):
+		status = http.StatusNotFound
+	}
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
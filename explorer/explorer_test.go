@@ -0,0 +1,254 @@
+package explorer_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	mcm "github.com/NickP005/go_mcminterface"
+	"github.com/NickP005/go_mcminterface/explorer"
+	"github.com/NickP005/go_mcminterface/mcmtest"
+)
+
+// blockResponse is the part of the block encoding the tests check
+type blockResponse struct {
+	Type    string         `json:"type"`
+	Body    []mcm.TXQENTRY `json:"body"`
+	Trailer mcm.BTRAILER   `json:"trailer"`
+}
+
+type balanceResponse struct {
+	Address string `json:"address"`
+	Tag     string `json:"tag"`
+	Balance uint64 `json:"balance"`
+}
+
+// do sends the request to handler and decodes the JSON answer into v,
+// returning the status
+func do(t *testing.T, handler http.Handler, method string, target string, body io.Reader, v any) int {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(method, target, body))
+	if content_type := recorder.Header().Get("Content-Type"); content_type != "application/json" {
+		t.Errorf("%s %s: content type %q", method, target, content_type)
+	}
+	if v != nil {
+		if err := json.Unmarshal(recorder.Body.Bytes(), v); err != nil {
+			t.Errorf("%s %s: %v in %s", method, target, err, recorder.Body.String())
+		}
+	}
+	return recorder.Code
+}
+
+// explorerChain returns a chain of 2 blocks whose ledger holds a tagged
+// address, and that address
+func explorerChain(t *testing.T) (*mcmtest.Chain, mcm.WotsAddress) {
+	tagged := mcm.NewWotsKeypair([]byte("tagged")).Address()
+	tagged.SetTAG([]byte("explorer tag"))
+	tagged.Amount = 5000
+	chain := mcmtest.NewChainWithLedger(tagged)
+
+	builder := mcm.TransactionBuilder{
+		Source:      mcm.NewWotsKeypair([]byte("source")),
+		Balance:     10000,
+		Destination: mcm.NewWotsKeypair([]byte("destination")).Address(),
+		Change:      mcm.NewWotsKeypair([]byte("change")).Address(),
+		Amount:      1000,
+	}
+	chain.SetBalance(builder.Source.Address(), 10000)
+	tx, err := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain.AddBlock([]mcm.TXQENTRY{{
+		Src_addr:     tx.Src_addr,
+		Dst_addr:     tx.Dst_addr,
+		Chg_addr:     tx.Chg_addr,
+		Send_total:   tx.Send_total,
+		Change_total: tx.Change_total,
+		Tx_fee:       tx.Tx_fee,
+		Tx_sig:       tx.Tx_sig,
+	}})
+	return chain, tagged
+}
+
+func TestBlocks(t *testing.T) {
+	chain, _ := explorerChain(t)
+	server := explorer.NewServer(mcmtest.NewTestNetwork(t, chain, chain, chain).Client(3))
+
+	for _, test := range []struct {
+		target string
+		bnum   uint64
+	}{
+		{"/blocks/0", 0},
+		{"/blocks/1", 1},
+		{"/blocks/latest", 1},
+	} {
+		var block blockResponse
+		if status := do(t, server, "GET", test.target, nil, &block); status != http.StatusOK {
+			t.Errorf("%s: status %d", test.target, status)
+			continue
+		}
+		hash, _ := chain.BlockHash(test.bnum)
+		if binary.LittleEndian.Uint64(block.Trailer.Bnum[:]) != test.bnum || block.Trailer.Bhash != hash {
+			t.Errorf("%s: not block %d", test.target, test.bnum)
+		}
+	}
+
+	var block blockResponse
+	do(t, server, "GET", "/blocks/1", nil, &block)
+	if block.Type != "normal" || len(block.Body) != 1 {
+		t.Errorf("block 1: type %q with %d transactions", block.Type, len(block.Body))
+	}
+}
+
+func TestTrailers(t *testing.T) {
+	chain, _ := explorerChain(t)
+	server := explorer.NewServer(mcmtest.NewTestNetwork(t, chain, chain, chain).Client(3))
+
+	var trailers []mcm.BTRAILER
+	if status := do(t, server, "GET", "/trailers?start=0&count=2", nil, &trailers); status != http.StatusOK {
+		t.Fatalf("status %d", status)
+	}
+	if len(trailers) != 2 {
+		t.Fatalf("%d trailers", len(trailers))
+	}
+	for i, trailer := range trailers {
+		hash, _ := chain.BlockHash(uint64(i))
+		if trailer.Bhash != hash {
+			t.Errorf("trailer %d does not match the chain", i)
+		}
+	}
+}
+
+func TestBalanceAndTag(t *testing.T) {
+	chain, tagged := explorerChain(t)
+	server := explorer.NewServer(mcmtest.NewTestNetwork(t, chain, chain, chain).Client(3))
+
+	destination := mcm.NewWotsKeypair([]byte("destination")).Address()
+	var balance balanceResponse
+	target := "/balance/" + hex.EncodeToString(destination.Address[:])
+	if status := do(t, server, "GET", target, nil, &balance); status != http.StatusOK {
+		t.Fatalf("balance: status %d", status)
+	}
+	if balance.Balance != 1000 || balance.Address != hex.EncodeToString(destination.Address[:]) {
+		t.Errorf("balance = %+v", balance)
+	}
+
+	for _, tag := range []string{hex.EncodeToString(tagged.GetTAG()), mcm.TagString(tagged.GetTAG())} {
+		var resolved balanceResponse
+		if status := do(t, server, "GET", "/tag/"+tag, nil, &resolved); status != http.StatusOK {
+			t.Errorf("tag %s: status %d", tag, status)
+			continue
+		}
+		if resolved.Address != hex.EncodeToString(tagged.Address[:]) || resolved.Balance != tagged.Amount {
+			t.Errorf("tag %s resolved to %+v", tag, resolved)
+		}
+	}
+}
+
+func TestNodes(t *testing.T) {
+	chain, _ := explorerChain(t)
+	server := explorer.NewServer(mcmtest.NewTestNetwork(t, chain, chain, chain).Client(3))
+
+	var nodes []mcm.RemoteNode
+	if status := do(t, server, "GET", "/nodes", nil, &nodes); status != http.StatusOK {
+		t.Fatalf("status %d", status)
+	}
+	if len(nodes) != 3 {
+		t.Errorf("%d nodes", len(nodes))
+	}
+}
+
+func TestSubmit(t *testing.T) {
+	chain, _ := explorerChain(t)
+	network := mcmtest.NewTestNetwork(t, chain)
+	server := explorer.NewServer(network.Client(1))
+
+	builder := mcm.TransactionBuilder{
+		Source:      mcm.NewWotsKeypair([]byte("destination")),
+		Balance:     1000,
+		Destination: mcm.NewWotsKeypair([]byte("source")).Address(),
+		Change:      mcm.NewWotsKeypair([]byte("second change")).Address(),
+		Amount:      100,
+	}
+	tx, err := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := json.Marshal(mcm.TXQENTRY{
+		Src_addr:     tx.Src_addr,
+		Dst_addr:     tx.Dst_addr,
+		Chg_addr:     tx.Chg_addr,
+		Send_total:   tx.Send_total,
+		Change_total: tx.Change_total,
+		Tx_fee:       tx.Tx_fee,
+		Tx_sig:       tx.Tx_sig,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var answer map[string]string
+	if status := do(t, server, "POST", "/tx", bytes.NewReader(body), &answer); status != http.StatusAccepted {
+		t.Fatalf("status %d: %v", status, answer)
+	}
+	if len(answer["tx_id"]) != 2*mcm.HASHLEN {
+		t.Errorf("tx_id = %q", answer["tx_id"])
+	}
+	node := network.Node("10.0.0.1")
+	node.Close()
+	received := node.Received()
+	if len(received) != 1 || received[0].Src_addr != tx.Src_addr || received[0].Tx_sig != tx.Tx_sig {
+		t.Errorf("node received %d transactions, not the submitted one", len(received))
+	}
+}
+
+func TestErrorStatus(t *testing.T) {
+	chain, _ := explorerChain(t)
+	server := explorer.NewServer(mcmtest.NewTestNetwork(t, chain, chain, chain).Client(3))
+	// no node answers the queries of this one
+	offline := explorer.NewServer(mcmtest.NewNetwork().Client(1))
+
+	unknown := mcm.NewWotsKeypair([]byte("unknown")).Address()
+	tests := []struct {
+		name    string
+		server  http.Handler
+		method  string
+		target  string
+		body    string
+		status  int
+		message string
+	}{
+		{"block number", server, "GET", "/blocks/abc", "", http.StatusBadRequest, "block number"},
+		{"missing start", server, "GET", "/trailers", "", http.StatusBadRequest, "start"},
+		{"count 0", server, "GET", "/trailers?start=0&count=0", "", http.StatusBadRequest, "count must be between"},
+		{"count above the limit", server, "GET", "/trailers?start=0&count=1001", "", http.StatusBadRequest, "count must be between"},
+		{"malformed address", server, "GET", "/balance/00ff", "", http.StatusBadRequest, "address"},
+		{"unknown address", server, "GET", "/balance/" + hex.EncodeToString(unknown.Address[:]), "", http.StatusNotFound, ""},
+		{"malformed tag", server, "GET", "/tag/not-a-tag", "", http.StatusBadRequest, "tag"},
+		{"unknown tag", server, "GET", "/tag/" + hex.EncodeToString([]byte("unknown tag.")), "", http.StatusNotFound, ""},
+		{"malformed transaction", server, "POST", "/tx", "{", http.StatusBadRequest, "transaction"},
+		{"missing addresses", server, "POST", "/tx", `{"tx_sig":"00"}`, http.StatusBadRequest, "transaction"},
+		{"block beyond the chain", server, "GET", "/blocks/5", "", http.StatusBadGateway, ""},
+		{"offline block", offline, "GET", "/blocks/latest", "", http.StatusBadGateway, ""},
+		{"offline genesis", offline, "GET", "/blocks/0", "", http.StatusBadGateway, ""},
+		{"offline trailers", offline, "GET", "/trailers?start=0", "", http.StatusBadGateway, ""},
+	}
+	for _, test := range tests {
+		var answer map[string]string
+		status := do(t, test.server, test.method, test.target, strings.NewReader(test.body), &answer)
+		if status != test.status {
+			t.Errorf("%s: status %d, want %d (%v)", test.name, status, test.status, answer["error"])
+		}
+		if answer["error"] == "" || !strings.Contains(answer["error"], test.message) {
+			t.Errorf("%s: error %q, want %q", test.name, answer["error"], test.message)
+		}
+	}
+}
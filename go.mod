@@ -2,4 +2,9 @@ module github.com/NickP005/go_mcminterface
 
 go 1.22.5
 
-require github.com/sigurn/crc16 v0.0.0-20240131213347-83fcde1e29d1
+require (
+	github.com/sigurn/crc16 v0.0.0-20240131213347-83fcde1e29d1
+	golang.org/x/crypto v0.31.0
+)
+
+require golang.org/x/sys v0.28.0 // indirect
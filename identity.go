@@ -0,0 +1,148 @@
+package go_mcminterface
+
+import (
+	"context"
+	"encoding/binary"
+	"time"
+)
+
+// Capability flags a node sets in the second byte of the TX version
+const (
+	CPUSH      = 1  /* node pushes blocks */
+	CWALLET    = 2  /* node is a wallet */
+	CSANCTUARY = 4  /* node is in sanctuary */
+	CMFEE      = 8  /* node has a custom mining fee */
+	CLOGGING   = 16 /* node has logging enabled */
+)
+
+// Weight multiplier of nodes speaking an older protocol version than the
+// newest seen, used by PickNodes
+const OUTDATED_NODE_WEIGHT = 0.25
+
+// NodeIdentity is what a node reports about itself in the header of its
+// answers: every TX carries the protocol version and capability flags of the
+// sender in Version, and its latest block in Cblock, Cblockhash and Weight.
+// The payload of the OP_IDENTIFY answer is not documented, so it is not read.
+type NodeIdentity struct {
+	IP              string
+	ProtocolVersion int           // PVERSION of the node, Version[0]
+	Capabilities    byte          // CPUSH, CWALLET, CSANCTUARY, ... flags, Version[1]
+	BlockNum        uint64        // latest block of the node
+	BlockHash       [HASHLEN]byte // hash of the latest block
+	Weight          [32]byte      // chain weight
+	Time            time.Time     // when the identity was received
+}
+
+// HasCapability reports whether the node advertises flag
+func (id *NodeIdentity) HasCapability(flag byte) bool {
+	return id.Capabilities&flag != 0
+}
+
+// identityFromTX builds the identity of the node from the header of its answer
+func identityFromTX(ip string, tx *TX) NodeIdentity {
+	return NodeIdentity{
+		IP:              ip,
+		ProtocolVersion: int(tx.Version[0]),
+		Capabilities:    tx.Version[1],
+		BlockNum:        binary.LittleEndian.Uint64(tx.Cblock[:]),
+		BlockHash:       tx.Cblockhash,
+		Weight:          tx.Weight,
+		Time:            time.Now(),
+	}
+}
+
+// Identify asks the node its identity with OP_IDENTIFY
+func (m *SocketData) Identify() (NodeIdentity, error) {
+	return m.IdentifyContext(context.Background())
+}
+
+// Identify asks the node its identity with OP_IDENTIFY, giving up when ctx is done
+func (m *SocketData) IdentifyContext(ctx context.Context) (NodeIdentity, error) {
+	m.send_tx = NewTX(nil)
+	m.send_tx.ID1 = m.recv_tx.ID1
+	m.send_tx.ID2 = m.recv_tx.ID2
+
+	// Send OP_IDENTIFY
+	err := m.SendOPContext(ctx, OP_IDENTIFY)
+	if err != nil {
+		return NodeIdentity{}, err
+	}
+
+	err = m.recvTX(ctx)
+	if err != nil {
+		return NodeIdentity{}, err
+	}
+
+	// Check if opcode is OP_IDENTIFY
+	if err := m.expectOP(OP_IDENTIFY); err != nil {
+		return NodeIdentity{}, err
+	}
+
+	return identityFromTX(m.IP, &m.recv_tx), nil
+}
+
+// QueryNodeIdentities asks every known node its identity and stores it in
+// Settings.Nodes, so that PickNodes can prefer up-to-date nodes
+func (c *Client) QueryNodeIdentities() ([]NodeIdentity, error) {
+	return c.QueryNodeIdentitiesContext(context.Background())
+}
+
+// QueryNodeIdentitiesContext is QueryNodeIdentities giving up when ctx is done
+func (c *Client) QueryNodeIdentitiesContext(ctx context.Context) ([]NodeIdentity, error) {
+	nodes := c.Nodes()
+	identities, err := queryNodes(ctx, c, nodes, func(ctx context.Context, sd *SocketData) (NodeIdentity, error) {
+		return sd.IdentifyContext(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c.nodes_mu.Lock()
+	for _, identity := range identities {
+		for i := range c.Settings.Nodes {
+			if c.Settings.Nodes[i].IP == identity.IP {
+				id := identity
+				c.Settings.Nodes[i].Identity = &id
+				c.Settings.Nodes[i].LastSeen = identity.Time
+			}
+		}
+	}
+	c.nodes_mu.Unlock()
+	return identities, nil
+}
+
+// QueryNodeIdentities asks every node of DefaultClient its identity
+func QueryNodeIdentities() ([]NodeIdentity, error) {
+	return DefaultClient.QueryNodeIdentities()
+}
+
+// QueryNodeIdentitiesContext is QueryNodeIdentities giving up when ctx is done
+func QueryNodeIdentitiesContext(ctx context.Context) ([]NodeIdentity, error) {
+	return DefaultClient.QueryNodeIdentitiesContext(ctx)
+}
+
+// VersionSpread counts the nodes by protocol version, 0 for the nodes never
+// identified
+func VersionSpread(nodes []RemoteNode) map[int]int {
+	spread := make(map[int]int)
+	for _, node := range nodes {
+		if node.Identity == nil {
+			spread[0]++
+			continue
+		}
+		spread[node.Identity.ProtocolVersion]++
+	}
+	return spread
+}
+
+// newestVersion returns the highest protocol version among nodes, 0 if none
+// was identified
+func newestVersion(nodes []RemoteNode) int {
+	newest := 0
+	for _, node := range nodes {
+		if node.Identity != nil && node.Identity.ProtocolVersion > newest {
+			newest = node.Identity.ProtocolVersion
+		}
+	}
+	return newest
+}
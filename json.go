@@ -0,0 +1,186 @@
+package go_mcminterface
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// JSON encodings: byte strings (hashes, addresses, signatures) as hex,
+// numbers as numbers
+
+type btrailerJSON struct {
+	Phash      string `json:"phash"`
+	Bnum       uint64 `json:"bnum"`
+	Mfee       uint64 `json:"mfee"`
+	Tcount     uint32 `json:"tcount"`
+	Time0      uint32 `json:"time0"`
+	Difficulty uint32 `json:"difficulty"`
+	Mroot      string `json:"mroot"`
+	Nonce      string `json:"nonce"`
+	Stime      uint32 `json:"stime"`
+	Bhash      string `json:"bhash"`
+}
+
+func (bt BTRAILER) MarshalJSON() ([]byte, error) {
+	return json.Marshal(btrailerJSON{
+		Phash:      hex.EncodeToString(bt.Phash[:]),
+		Bnum:       binary.LittleEndian.Uint64(bt.Bnum[:]),
+		Mfee:       binary.LittleEndian.Uint64(bt.Mfee[:]),
+		Tcount:     binary.LittleEndian.Uint32(bt.Tcount[:]),
+		Time0:      binary.LittleEndian.Uint32(bt.Time0[:]),
+		Difficulty: binary.LittleEndian.Uint32(bt.Difficulty[:]),
+		Mroot:      hex.EncodeToString(bt.Mroot[:]),
+		Nonce:      hex.EncodeToString(bt.Nonce[:]),
+		Stime:      binary.LittleEndian.Uint32(bt.Stime[:]),
+		Bhash:      hex.EncodeToString(bt.Bhash[:]),
+	})
+}
+
+func (bt *BTRAILER) UnmarshalJSON(data []byte) error {
+	var v btrailerJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	var trailer BTRAILER
+	for _, field := range []struct {
+		name string
+		hex  string
+		dst  []byte
+	}{
+		{"phash", v.Phash, trailer.Phash[:]},
+		{"mroot", v.Mroot, trailer.Mroot[:]},
+		{"nonce", v.Nonce, trailer.Nonce[:]},
+		{"bhash", v.Bhash, trailer.Bhash[:]},
+	} {
+		if err := decodeHexField(field.name, field.hex, field.dst); err != nil {
+			return err
+		}
+	}
+	binary.LittleEndian.PutUint64(trailer.Bnum[:], v.Bnum)
+	binary.LittleEndian.PutUint64(trailer.Mfee[:], v.Mfee)
+	binary.LittleEndian.PutUint32(trailer.Tcount[:], v.Tcount)
+	binary.LittleEndian.PutUint32(trailer.Time0[:], v.Time0)
+	binary.LittleEndian.PutUint32(trailer.Difficulty[:], v.Difficulty)
+	binary.LittleEndian.PutUint32(trailer.Stime[:], v.Stime)
+	*bt = trailer
+	return nil
+}
+
+type txqentryJSON struct {
+	Src_addr     string `json:"src_addr"`
+	Dst_addr     string `json:"dst_addr"`
+	Chg_addr     string `json:"chg_addr"`
+	Send_total   uint64 `json:"send_total"`
+	Change_total uint64 `json:"change_total"`
+	Tx_fee       uint64 `json:"tx_fee"`
+	Tx_sig       string `json:"tx_sig"`
+	Tx_id        string `json:"tx_id,omitempty"`
+}
+
+func (tx TXQENTRY) MarshalJSON() ([]byte, error) {
+	return json.Marshal(txqentryJSON{
+		Src_addr:     hex.EncodeToString(tx.Src_addr[:]),
+		Dst_addr:     hex.EncodeToString(tx.Dst_addr[:]),
+		Chg_addr:     hex.EncodeToString(tx.Chg_addr[:]),
+		Send_total:   binary.LittleEndian.Uint64(tx.Send_total[:]),
+		Change_total: binary.LittleEndian.Uint64(tx.Change_total[:]),
+		Tx_fee:       binary.LittleEndian.Uint64(tx.Tx_fee[:]),
+		Tx_sig:       hex.EncodeToString(tx.Tx_sig[:]),
+		Tx_id:        hex.EncodeToString(tx.Tx_id[:]),
+	})
+}
+
+// UnmarshalJSON decodes a transaction, tx_id may be left out
+func (tx *TXQENTRY) UnmarshalJSON(data []byte) error {
+	var v txqentryJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	var entry TXQENTRY
+	for _, field := range []struct {
+		name string
+		hex  string
+		dst  []byte
+	}{
+		{"src_addr", v.Src_addr, entry.Src_addr[:]},
+		{"dst_addr", v.Dst_addr, entry.Dst_addr[:]},
+		{"chg_addr", v.Chg_addr, entry.Chg_addr[:]},
+		{"tx_sig", v.Tx_sig, entry.Tx_sig[:]},
+	} {
+		if err := decodeHexField(field.name, field.hex, field.dst); err != nil {
+			return err
+		}
+	}
+	if v.Tx_id != "" {
+		if err := decodeHexField("tx_id", v.Tx_id, entry.Tx_id[:]); err != nil {
+			return err
+		}
+	}
+	binary.LittleEndian.PutUint64(entry.Send_total[:], v.Send_total)
+	binary.LittleEndian.PutUint64(entry.Change_total[:], v.Change_total)
+	binary.LittleEndian.PutUint64(entry.Tx_fee[:], v.Tx_fee)
+	*tx = entry
+	return nil
+}
+
+// Transaction returns the transaction to submit, without its id
+func (tx *TXQENTRY) Transaction() Transaction {
+	return Transaction{
+		Src_addr:     tx.Src_addr,
+		Dst_addr:     tx.Dst_addr,
+		Chg_addr:     tx.Chg_addr,
+		Send_total:   tx.Send_total,
+		Change_total: tx.Change_total,
+		Tx_fee:       tx.Tx_fee,
+		Tx_sig:       tx.Tx_sig,
+	}
+}
+
+type bheaderJSON struct {
+	Hdrlen  uint32 `json:"hdrlen"`
+	Maddr   string `json:"maddr,omitempty"`
+	Mreward uint64 `json:"mreward,omitempty"`
+}
+
+var blockTypeNames = map[int]string{
+	BLOCK_NORMAL:     "normal",
+	BLOCK_PSEUDO:     "pseudo",
+	BLOCK_NEOGENESIS: "neogenesis",
+	BLOCK_INVALID:    "invalid",
+}
+
+// MarshalJSON encodes the block with its kind. The ledger of a neo-genesis
+// block, too large for a response, is only counted: see Ledger.
+func (bd Block) MarshalJSON() ([]byte, error) {
+	header := bheaderJSON{Hdrlen: bd.Header.Hdrlen}
+	if bd.Type() == BLOCK_NORMAL {
+		header.Maddr = hex.EncodeToString(bd.Header.Maddr[:])
+		header.Mreward = bd.Header.Mreward
+	}
+	body := bd.Body
+	if body == nil {
+		body = []TXQENTRY{}
+	}
+	return json.Marshal(struct {
+		Type          string      `json:"type"`
+		Header        bheaderJSON `json:"header"`
+		Body          []TXQENTRY  `json:"body"`
+		LedgerEntries int         `json:"ledger_entries,omitempty"`
+		Trailer       BTRAILER    `json:"trailer"`
+	}{blockTypeNames[bd.Type()], header, body, len(bd.Ledger), bd.Trailer})
+}
+
+// decodeHexField decodes a hex string of exactly len(dst) bytes into dst
+func decodeHexField(name string, s string, dst []byte) error {
+	bytes, err := hex.DecodeString(s)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	if len(bytes) != len(dst) {
+		return fmt.Errorf("%s: %d bytes, expected %d", name, len(bytes), len(dst))
+	}
+	copy(dst, bytes)
+	return nil
+}
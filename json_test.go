@@ -0,0 +1,166 @@
+package go_mcminterface_test
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	mcm "github.com/NickP005/go_mcminterface"
+	"github.com/NickP005/go_mcminterface/mcmtest"
+)
+
+// signedEntry returns a signed transaction with its id
+func signedEntry(t *testing.T) mcm.TXQENTRY {
+	builder := mcm.TransactionBuilder{
+		Source:      mcm.NewWotsKeypair([]byte("source")),
+		Balance:     10000,
+		Destination: mcm.NewWotsKeypair([]byte("destination")).Address(),
+		Change:      mcm.NewWotsKeypair([]byte("change")).Address(),
+		Amount:      1000,
+	}
+	tx, err := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mcm.TXQENTRY{
+		Src_addr:     tx.Src_addr,
+		Dst_addr:     tx.Dst_addr,
+		Chg_addr:     tx.Chg_addr,
+		Send_total:   tx.Send_total,
+		Change_total: tx.Change_total,
+		Tx_fee:       tx.Tx_fee,
+		Tx_sig:       tx.Tx_sig,
+		Tx_id:        [mcm.HASHLEN]byte{1, 2, 3},
+	}
+}
+
+func TestTXQENTRYJSON(t *testing.T) {
+	entry := signedEntry(t)
+	data, err := json.Marshal(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded mcm.TXQENTRY
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded != entry {
+		t.Error("transaction changed through JSON")
+	}
+
+	// tx_id may be left out
+	var fields map[string]any
+	json.Unmarshal(data, &fields)
+	if fields["send_total"] != float64(1000) || fields["tx_fee"] != float64(mcm.MFEE) {
+		t.Errorf("amounts encoded as %v and %v", fields["send_total"], fields["tx_fee"])
+	}
+	delete(fields, "tx_id")
+	data, _ = json.Marshal(fields)
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Tx_id != [mcm.HASHLEN]byte{} || decoded.Transaction() != entry.Transaction() {
+		t.Error("transaction without tx_id changed through JSON")
+	}
+}
+
+func TestBTRAILERJSON(t *testing.T) {
+	chain := mcmtest.NewChain()
+	entry := signedEntry(t)
+	mine(chain, entry.Transaction())
+	bytes, _ := chain.BlockBytes(1)
+	trailer := mcm.BlockFromBytes(bytes).Trailer
+	binary.LittleEndian.PutUint32(trailer.Difficulty[:], 42)
+	trailer.Nonce = [mcm.HASHLEN]byte{9, 8, 7}
+
+	data, err := json.Marshal(trailer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded mcm.BTRAILER
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded != trailer {
+		t.Error("trailer changed through JSON")
+	}
+	if !strings.Contains(string(data), `"bnum":1,`) || !strings.Contains(string(data), `"difficulty":42,`) {
+		t.Errorf("numbers not encoded as numbers: %s", data)
+	}
+}
+
+func TestBlockJSON(t *testing.T) {
+	chain := mcmtest.NewChain()
+	entry := signedEntry(t)
+	mine(chain, entry.Transaction())
+	bytes, _ := chain.BlockBytes(1)
+	block := mcm.BlockFromBytes(bytes)
+
+	data, err := json.Marshal(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		Type   string `json:"type"`
+		Header struct {
+			Hdrlen  uint32 `json:"hdrlen"`
+			Mreward uint64 `json:"mreward"`
+		} `json:"header"`
+		Body    []mcm.TXQENTRY `json:"body"`
+		Trailer mcm.BTRAILER   `json:"trailer"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Type != "normal" || decoded.Header.Hdrlen != block.Header.Hdrlen || decoded.Header.Mreward != block.Header.Mreward {
+		t.Errorf("block encoded as %s with header %+v", decoded.Type, decoded.Header)
+	}
+	if len(decoded.Body) != 1 || decoded.Body[0] != block.Body[0] || decoded.Trailer != block.Trailer {
+		t.Error("block changed through JSON")
+	}
+
+	// a pseudo block has an empty body and no miner
+	chain.AddPseudoBlock()
+	bytes, _ = chain.BlockBytes(2)
+	data, _ = json.Marshal(mcm.BlockFromBytes(bytes))
+	if !strings.Contains(string(data), `"type":"pseudo"`) || !strings.Contains(string(data), `"body":[]`) || strings.Contains(string(data), "maddr") {
+		t.Errorf("pseudo block encoded as %s", data)
+	}
+}
+
+func TestJSONRejects(t *testing.T) {
+	valid, _ := json.Marshal(signedEntry(t))
+	var fields map[string]any
+	json.Unmarshal(valid, &fields)
+
+	tests := []struct {
+		name   string
+		field  string
+		value  any
+		reason string
+	}{
+		{"short address", "src_addr", "00ff", "src_addr: 2 bytes"},
+		{"invalid hex", "dst_addr", "zz", "dst_addr"},
+		{"short signature", "tx_sig", "00", "tx_sig: 1 bytes"},
+		{"short tx_id", "tx_id", "00", "tx_id: 1 bytes"},
+		{"negative amount", "send_total", -1, "send_total"},
+	}
+	for _, test := range tests {
+		modified := map[string]any{}
+		for key, value := range fields {
+			modified[key] = value
+		}
+		modified[test.field] = test.value
+		data, _ := json.Marshal(modified)
+		var entry mcm.TXQENTRY
+		if err := json.Unmarshal(data, &entry); err == nil || !strings.Contains(err.Error(), test.reason) {
+			t.Errorf("%s: err = %v, want %q", test.name, err, test.reason)
+		}
+	}
+
+	var trailer mcm.BTRAILER
+	if err := json.Unmarshal([]byte(`{"phash":"00"}`), &trailer); err == nil || !strings.Contains(err.Error(), "phash") {
+		t.Errorf("short phash: err = %v", err)
+	}
+}
@@ -0,0 +1,158 @@
+package go_mcminterface
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// KEYSTORE_VERSION is the version of the keystore format
+const KEYSTORE_VERSION = 1
+
+// scrypt cost of new keystores
+const (
+	SCRYPT_N = 1 << 15
+	SCRYPT_R = 8
+	SCRYPT_P = 1
+)
+
+// ErrWrongPassword is returned when a keystore cannot be decrypted
+var ErrWrongPassword = errors.New("wrong password or corrupted keystore")
+
+// keystoreFile is the JSON content of a keystore: the wallet encrypted with
+// AES-256-GCM, under a key derived from the password with scrypt
+type keystoreFile struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	N          int    `json:"n"`
+	R          int    `json:"r"`
+	P          int    `json:"p"`
+	Salt       []byte `json:"salt"`
+	Cipher     string `json:"cipher"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// aead derives the AES-256-GCM cipher of the keystore from password
+func (k *keystoreFile) aead(password string) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(password), k.Salt, k.N, k.R, k.P, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// EncryptWallet encrypts the state of wallet (master seed, tag, signed keys)
+// with password, returning the keystore JSON
+func EncryptWallet(wallet *Wallet, password string) ([]byte, error) {
+	plaintext, err := json.Marshal(wallet)
+	if err != nil {
+		return nil, err
+	}
+	k := keystoreFile{
+		Version: KEYSTORE_VERSION,
+		KDF:     "scrypt",
+		N:       SCRYPT_N,
+		R:       SCRYPT_R,
+		P:       SCRYPT_P,
+		Salt:    make([]byte, 32),
+		Cipher:  "aes-256-gcm",
+	}
+	if _, err := rand.Read(k.Salt); err != nil {
+		return nil, err
+	}
+	aead, err := k.aead(password)
+	if err != nil {
+		return nil, err
+	}
+	k.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(k.Nonce); err != nil {
+		return nil, err
+	}
+	k.Ciphertext = aead.Seal(nil, k.Nonce, plaintext, k.Salt)
+	return json.MarshalIndent(k, "", "  ")
+}
+
+// DecryptWallet decrypts a keystore JSON made by EncryptWallet
+func DecryptWallet(data []byte, password string) (*Wallet, error) {
+	var k keystoreFile
+	if err := json.Unmarshal(data, &k); err != nil {
+		return nil, err
+	}
+	if k.Version != KEYSTORE_VERSION || k.KDF != "scrypt" || k.Cipher != "aes-256-gcm" {
+		return nil, fmt.Errorf("unsupported keystore version %d (%s, %s)", k.Version, k.KDF, k.Cipher)
+	}
+	aead, err := k.aead(password)
+	if err != nil {
+		return nil, err
+	}
+	if len(k.Nonce) != aead.NonceSize() {
+		return nil, ErrWrongPassword
+	}
+	plaintext, err := aead.Open(nil, k.Nonce, k.Ciphertext, k.Salt)
+	if err != nil {
+		return nil, ErrWrongPassword
+	}
+	wallet := &Wallet{}
+	if err := json.Unmarshal(plaintext, wallet); err != nil {
+		return nil, err
+	}
+	if wallet.Signed == nil {
+		wallet.Signed = make(map[uint64]bool)
+	}
+	return wallet, nil
+}
+
+// SaveKeystore encrypts wallet with password and writes it to path, readable
+// by the owner only. The file is replaced atomically.
+func SaveKeystore(path string, wallet *Wallet, password string) error {
+	data, err := EncryptWallet(wallet, password)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".keystore-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// LoadKeystore reads and decrypts the wallet saved at path
+func LoadKeystore(path string, password string) (*Wallet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return DecryptWallet(data, password)
+}
+
+// ChangeKeystorePassword encrypts the keystore at path with a new password
+func ChangeKeystorePassword(path string, old_password string, new_password string) error {
+	wallet, err := LoadKeystore(path, old_password)
+	if err != nil {
+		return err
+	}
+	return SaveKeystore(path, wallet, new_password)
+}
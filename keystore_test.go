@@ -0,0 +1,139 @@
+package go_mcminterface_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	mcm "github.com/NickP005/go_mcminterface"
+)
+
+func testWallet() *mcm.Wallet {
+	wallet := mcm.NewWallet([]byte("master seed"), []byte("wallet tag.."))
+	wallet.TagOnChain = true
+	wallet.Index = 2
+	wallet.Signed[0] = true
+	wallet.Signed[1] = true
+	return wallet
+}
+
+func TestKeystoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wallet.json")
+	wallet := testWallet()
+	if err := mcm.SaveKeystore(path, wallet, "password"); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("keystore mode = %v", info.Mode().Perm())
+	}
+	data, _ := os.ReadFile(path)
+	if bytes.Contains(data, []byte("master seed")) || bytes.Contains(data, []byte("wallet tag")) {
+		t.Error("keystore holds the wallet in clear")
+	}
+
+	loaded, err := mcm.LoadKeystore(path, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(loaded.MasterSeed, wallet.MasterSeed) || !bytes.Equal(loaded.Tag, wallet.Tag) ||
+		loaded.TagOnChain != wallet.TagOnChain || loaded.Index != wallet.Index ||
+		!loaded.Signed[0] || !loaded.Signed[1] || len(loaded.Signed) != 2 {
+		t.Errorf("loaded wallet = %+v", loaded)
+	}
+	if loaded.Current() != wallet.Current() {
+		t.Error("loaded wallet derives another address")
+	}
+}
+
+func TestKeystoreWrongPassword(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wallet.json")
+	if err := mcm.SaveKeystore(path, testWallet(), "password"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mcm.LoadKeystore(path, "Password"); !errors.Is(err, mcm.ErrWrongPassword) {
+		t.Errorf("wrong password: err = %v, want ErrWrongPassword", err)
+	}
+}
+
+func TestKeystoreTampered(t *testing.T) {
+	data, err := mcm.EncryptWallet(testWallet(), "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		tamper func(k map[string]any)
+	}{
+		{"ciphertext", func(k map[string]any) { k["ciphertext"] = flipByte(k["ciphertext"].(string)) }},
+		{"nonce", func(k map[string]any) { k["nonce"] = flipByte(k["nonce"].(string)) }},
+		{"salt", func(k map[string]any) { k["salt"] = flipByte(k["salt"].(string)) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var k map[string]any
+			if err := json.Unmarshal(data, &k); err != nil {
+				t.Fatal(err)
+			}
+			tt.tamper(k)
+			tampered, _ := json.Marshal(k)
+			if _, err := mcm.DecryptWallet(tampered, "password"); !errors.Is(err, mcm.ErrWrongPassword) {
+				t.Errorf("err = %v, want ErrWrongPassword", err)
+			}
+		})
+	}
+
+	var k map[string]any
+	json.Unmarshal(data, &k)
+	k["version"] = 2
+	other, _ := json.Marshal(k)
+	if _, err := mcm.DecryptWallet(other, "password"); err == nil || errors.Is(err, mcm.ErrWrongPassword) {
+		t.Errorf("unknown version: err = %v", err)
+	}
+}
+
+// flipByte flips the first byte of a base64 JSON []byte
+func flipByte(b64 string) string {
+	var b []byte
+	json.Unmarshal([]byte(`"`+b64+`"`), &b)
+	b[0] ^= 1
+	out, _ := json.Marshal(b)
+	return string(out[1 : len(out)-1])
+}
+
+func TestChangeKeystorePassword(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wallet.json")
+	if err := mcm.SaveKeystore(path, testWallet(), "old"); err != nil {
+		t.Fatal(err)
+	}
+	if err := mcm.ChangeKeystorePassword(path, "wrong", "new"); !errors.Is(err, mcm.ErrWrongPassword) {
+		t.Fatalf("wrong old password: err = %v", err)
+	}
+	if _, err := mcm.LoadKeystore(path, "old"); err != nil {
+		t.Fatalf("failed change altered the keystore: %v", err)
+	}
+
+	if err := mcm.ChangeKeystorePassword(path, "old", "new"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mcm.LoadKeystore(path, "old"); !errors.Is(err, mcm.ErrWrongPassword) {
+		t.Errorf("old password still opens the keystore: err = %v", err)
+	}
+	wallet, err := mcm.LoadKeystore(path, "new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wallet.Index != 2 || !wallet.TagOnChain {
+		t.Errorf("wallet after the change = %+v", wallet)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("%d files left in the keystore directory", len(entries))
+	}
+}
@@ -0,0 +1,148 @@
+package go_mcminterface
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// LENTRY_LEN is the size of a ledger entry: an address and its balance
+const LENTRY_LEN = TXADDRLEN + TXAMOUNT
+
+// Ledger is a ledger snapshot (ledger.dat, or the body of a neo-genesis
+// block): entries sorted by address, looked up by binary search
+type Ledger struct {
+	entries []WotsAddress
+	tags    []int // entries with a tag, sorted by tag
+}
+
+// LedgerFromBytes parses ledger entries, which must be sorted by address
+func LedgerFromBytes(data []byte) (*Ledger, error) {
+	if len(data)%LENTRY_LEN != 0 {
+		return nil, fmt.Errorf("ledger size %d is not a multiple of %d", len(data), LENTRY_LEN)
+	}
+	entries := make([]WotsAddress, len(data)/LENTRY_LEN)
+	for i := range entries {
+		entry := data[i*LENTRY_LEN : (i+1)*LENTRY_LEN]
+		entries[i] = WotsAddressFromBytes(entry[:TXADDRLEN])
+		entries[i].SetAmountBytes(entry[TXADDRLEN:])
+		if i > 0 && bytes.Compare(entries[i-1].Address[:], entries[i].Address[:]) >= 0 {
+			return nil, fmt.Errorf("ledger entry %d is out of order", i)
+		}
+	}
+	return newLedger(entries), nil
+}
+
+// ledgerFromBalances builds a ledger from balances by address, dropping the
+// empty ones
+func ledgerFromBalances(balances map[[TXADDRLEN]byte]uint64) *Ledger {
+	entries := make([]WotsAddress, 0, len(balances))
+	for address, balance := range balances {
+		if balance > 0 {
+			entries = append(entries, WotsAddress{Address: address, Amount: balance})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i].Address[:], entries[j].Address[:]) < 0
+	})
+	return newLedger(entries)
+}
+
+// newLedger indexes the tags of entries sorted by address
+func newLedger(entries []WotsAddress) *Ledger {
+	l := &Ledger{entries: entries}
+	for i := range l.entries {
+		if !l.entries[i].IsDefaultTag() {
+			l.tags = append(l.tags, i)
+		}
+	}
+	sort.Slice(l.tags, func(a, b int) bool {
+		return bytes.Compare(l.entries[l.tags[a]].GetTAG(), l.entries[l.tags[b]].GetTAG()) < 0
+	})
+	return l
+}
+
+// ReadLedger reads a whole ledger from r
+func ReadLedger(r io.Reader) (*Ledger, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return LedgerFromBytes(data)
+}
+
+// LoadLedger reads the ledger file at path
+func LoadLedger(path string) (*Ledger, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return LedgerFromBytes(data)
+}
+
+// Len returns the number of entries
+func (l *Ledger) Len() int {
+	return len(l.entries)
+}
+
+// Entries returns the entries, sorted by address
+func (l *Ledger) Entries() []WotsAddress {
+	return l.entries
+}
+
+// Bytes serializes the ledger
+func (l *Ledger) Bytes() []byte {
+	data := make([]byte, 0, len(l.entries)*LENTRY_LEN)
+	for i := range l.entries {
+		data = append(data, l.entries[i].Address[:]...)
+		data = append(data, l.entries[i].GetAmountBytes()...)
+	}
+	return data
+}
+
+// Balance looks up the balance of address
+func (l *Ledger) Balance(address WotsAddress) (uint64, bool) {
+	i := sort.Search(len(l.entries), func(i int) bool {
+		return bytes.Compare(l.entries[i].Address[:], address.Address[:]) >= 0
+	})
+	if i < len(l.entries) && l.entries[i].Address == address.Address {
+		return l.entries[i].Amount, true
+	}
+	return 0, false
+}
+
+// Resolve looks up the address holding tag, with its balance
+func (l *Ledger) Resolve(tag []byte) (WotsAddress, bool) {
+	i := sort.Search(len(l.tags), func(i int) bool {
+		return bytes.Compare(l.entries[l.tags[i]].GetTAG(), tag) >= 0
+	})
+	if i < len(l.tags) && bytes.Equal(l.entries[l.tags[i]].GetTAG(), tag) {
+		return l.entries[l.tags[i]], true
+	}
+	return WotsAddress{}, false
+}
+
+// CrossCheckBalance compares the balance of address in the ledger with the
+// one agreed by the network. The ledger being a snapshot, a difference may
+// come from later blocks.
+func (c *Client) CrossCheckBalance(ledger *Ledger, address WotsAddress) error {
+	return c.CrossCheckBalanceContext(context.Background(), ledger, address)
+}
+
+// CrossCheckBalanceContext is CrossCheckBalance giving up when ctx is done
+func (c *Client) CrossCheckBalanceContext(ctx context.Context, ledger *Ledger, address WotsAddress) error {
+	local, _ := ledger.Balance(address)
+	remote, err := c.QueryBalanceContext(ctx, hex.EncodeToString(address.Address[:]))
+	if err != nil && !errors.Is(err, ErrAddressNotFound) {
+		return err
+	}
+	if local != remote {
+		return fmt.Errorf("ledger balance %d differs from network balance %d", local, remote)
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package go_mcminterface_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	mcm "github.com/NickP005/go_mcminterface"
+	"github.com/NickP005/go_mcminterface/mcmtest"
+)
+
+// ledgerChain returns a chain whose ledger holds untagged and tagged
+// addresses, and those addresses
+func ledgerChain() (*mcmtest.Chain, []mcm.WotsAddress) {
+	chain := mcmtest.NewChain()
+	var addresses []mcm.WotsAddress
+	for i, seed := range []string{"alice", "bob", "carol", "dave"} {
+		address := mcm.NewWotsKeypair([]byte(seed)).Address()
+		if i%2 == 1 {
+			address.SetTAG([]byte(seed + " tag......")[:mcm.TXTAGLEN])
+		}
+		address.Amount = uint64(1000 * (i + 1))
+		chain.SetBalance(address, address.Amount)
+		addresses = append(addresses, address)
+	}
+	return chain, addresses
+}
+
+func TestLedgerLookup(t *testing.T) {
+	chain, addresses := ledgerChain()
+	data := chain.Ledger()
+	path := filepath.Join(t.TempDir(), "ledger.dat")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	ledger, err := mcm.LoadLedger(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ledger.Len() != len(addresses) || !bytes.Equal(ledger.Bytes(), data) {
+		t.Fatal("ledger does not give back its bytes")
+	}
+
+	for _, address := range addresses {
+		balance, found := ledger.Balance(address)
+		if !found || balance != address.Amount {
+			t.Errorf("balance of %x = %d, found %v", address.GetTAG(), balance, found)
+		}
+		resolved, found := ledger.Resolve(address.GetTAG())
+		if address.IsDefaultTag() {
+			if found {
+				t.Error("untagged address resolved by the default tag")
+			}
+			continue
+		}
+		if !found || resolved.Address != address.Address || resolved.Amount != address.Amount {
+			t.Errorf("tag %s not resolved", address.GetTAG())
+		}
+	}
+
+	missing := mcm.NewWotsKeypair([]byte("missing")).Address()
+	if _, found := ledger.Balance(missing); found {
+		t.Error("missing address found")
+	}
+	// past the last entry
+	var last mcm.WotsAddress
+	for i := range last.Address {
+		last.Address[i] = 0xff
+	}
+	if _, found := ledger.Balance(last); found {
+		t.Error("address past the last entry found")
+	}
+	for _, tag := range [][]byte{[]byte("missing tag."), make([]byte, mcm.TXTAGLEN), bytes.Repeat([]byte{0xff}, mcm.TXTAGLEN)} {
+		if _, found := ledger.Resolve(tag); found {
+			t.Errorf("missing tag %x resolved", tag)
+		}
+	}
+
+	empty, err := mcm.LedgerFromBytes(nil)
+	if err != nil || empty.Len() != 0 {
+		t.Fatalf("empty ledger: %v", err)
+	}
+	if _, found := empty.Balance(addresses[0]); found {
+		t.Error("address found in an empty ledger")
+	}
+}
+
+func TestLedgerRejects(t *testing.T) {
+	chain, _ := ledgerChain()
+	data := chain.Ledger()
+	entry := func(i int) []byte {
+		return data[i*mcm.LENTRY_LEN : (i+1)*mcm.LENTRY_LEN]
+	}
+	join := func(entries ...[]byte) []byte {
+		return bytes.Join(entries, nil)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"unsorted", join(entry(1), entry(0), entry(2), entry(3))},
+		{"last two swapped", join(entry(0), entry(1), entry(3), entry(2))},
+		{"duplicate", join(entry(0), entry(1), entry(1), entry(2))},
+		{"truncated", data[:len(data)-1]},
+		{"trailing byte", append(append([]byte{}, data...), 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := mcm.LedgerFromBytes(tt.data); err == nil {
+				t.Error("malformed ledger parsed")
+			}
+		})
+	}
+	if _, err := mcm.LoadLedger(filepath.Join(t.TempDir(), "missing.dat")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("missing file: err = %v", err)
+	}
+}
+
+func TestCrossCheckBalance(t *testing.T) {
+	chain, addresses := ledgerChain()
+	ledger, err := mcm.LedgerFromBytes(chain.Ledger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := mcmtest.NewTestNetwork(t, chain, chain, chain).Client(3)
+
+	if err := client.CrossCheckBalance(ledger, addresses[0]); err != nil {
+		t.Errorf("matching balance: %v", err)
+	}
+	// unknown to both
+	if err := client.CrossCheckBalance(ledger, mcm.NewWotsKeypair([]byte("missing")).Address()); err != nil {
+		t.Errorf("address missing on both sides: %v", err)
+	}
+
+	// the network moved on after the snapshot
+	chain.SetBalance(addresses[1], 5)
+	if err := client.CrossCheckBalance(ledger, addresses[1]); err == nil {
+		t.Error("balance mismatch not reported")
+	}
+	chain.RemoveAddress(addresses[2])
+	if err := client.CrossCheckBalance(ledger, addresses[2]); err == nil {
+		t.Error("address spent on the network not reported")
+	}
+	funded := mcm.NewWotsKeypair([]byte("funded later")).Address()
+	chain.SetBalance(funded, 10)
+	if err := client.CrossCheckBalance(ledger, funded); err == nil {
+		t.Error("address missing from the ledger not reported")
+	}
+
+	// network errors are not mismatches
+	other, another := mcmtest.NewChain(), mcmtest.NewChain()
+	other.SetBalance(addresses[3], 1)
+	another.SetBalance(addresses[3], 2)
+	lying := mcmtest.NewTestNetwork(t, chain, other, another).Client(3)
+	if err := lying.CrossCheckBalance(ledger, addresses[3]); !errors.Is(err, &mcm.ErrNoQuorum{}) {
+		t.Errorf("no quorum: err = %v", err)
+	}
+}
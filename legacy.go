@@ -0,0 +1,131 @@
+package go_mcminterface
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrLegacyWalletUnsupported is returned for files that are not a plain
+// address file, such as the wallet file of the original Mochimo wallet,
+// whose format is not implemented
+var ErrLegacyWalletUnsupported = errors.New("unsupported legacy wallet file")
+
+// LegacyEntry is an address of the original Mochimo wallet. Legacy keys are
+// not derived like WotsKeypair: the secret is the private seed itself, the
+// public and address seeds are those of the address.
+type LegacyEntry struct {
+	Name    string
+	Address WotsAddress
+	Secret  []byte // set by the caller to move the funds, address files hold none
+}
+
+// Keypair returns the keypair signing for the entry, false if the secret is
+// missing or does not generate the address
+func (e *LegacyEntry) Keypair() (WotsKeypair, bool) {
+	if len(e.Secret) != WOTS_N {
+		return WotsKeypair{}, false
+	}
+	var keypair WotsKeypair
+	copy(keypair.PrivateSeed[:], e.Secret)
+	copy(keypair.PublicSeed[:], e.Address.Address[WOTS_PUB_SEED:WOTS_ADDR_SEED])
+	copy(keypair.AddrSeed[:], e.Address.Address[WOTS_ADDR_SEED:])
+	generated := keypair.Address()
+	if !bytes.Equal(generated.Address[:WOTS_PK_LEN], e.Address.Address[:WOTS_PK_LEN]) {
+		return WotsKeypair{}, false
+	}
+	return keypair, true
+}
+
+// ReadLegacyFile reads a file holding a single 2208 bytes address, as binary
+// (like the maddr.dat mining address of a node) or hex. The entry is named
+// after the file. Wallet files are not parsed.
+func ReadLegacyFile(path string) (LegacyEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return LegacyEntry{}, err
+	}
+	// hex exports
+	if decoded, err := hex.DecodeString(strings.TrimSpace(string(data))); err == nil {
+		data = decoded
+	}
+	if len(data) != TXADDRLEN {
+		return LegacyEntry{}, fmt.Errorf("%s: %w (%d bytes)", path, ErrLegacyWalletUnsupported, len(data))
+	}
+	return LegacyEntry{
+		Name:    strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)),
+		Address: WotsAddressFromBytes(data),
+	}, nil
+}
+
+// LegacyMigration is the outcome of the import of a legacy entry
+type LegacyMigration struct {
+	Entry   LegacyEntry
+	Balance uint64
+	Tx      *Transaction // moving the balance to the wallet, nil in dry run
+	Err     error        // why the entry is not migrated
+}
+
+// ImportLegacy queries the balance of the legacy entries and, unless
+// dry_run, builds the transactions moving each funded one to the current
+// address of the wallet, for SubmitTransaction. Tagged entries are reported
+// but not moved, as their tag cannot follow the funds into the wallet.
+func (w *Wallet) ImportLegacy(entries []LegacyEntry, dry_run bool) ([]LegacyMigration, error) {
+	return w.ImportLegacyContext(context.Background(), entries, dry_run)
+}
+
+// ImportLegacyContext is ImportLegacy giving up when ctx is done
+func (w *Wallet) ImportLegacyContext(ctx context.Context, entries []LegacyEntry, dry_run bool) ([]LegacyMigration, error) {
+	c := w.client()
+	report := make([]LegacyMigration, len(entries))
+	for i, entry := range entries {
+		report[i].Entry = entry
+		balance, err := c.QueryBalanceContext(ctx, hex.EncodeToString(entry.Address.Address[:]))
+		if err != nil && !errors.Is(err, ErrAddressNotFound) {
+			if ctx.Err() != nil {
+				return report, ctx.Err()
+			}
+			report[i].Err = err
+			continue
+		}
+		report[i].Balance = balance
+		c.logger().Info("legacy address", "name", entry.Name, "balance", balance)
+		if dry_run || balance == 0 {
+			continue
+		}
+
+		keypair, ok := entry.Keypair()
+		switch {
+		case !ok:
+			report[i].Err = fmt.Errorf("no matching secret for %s", entry.Name)
+			continue
+		case !entry.Address.IsDefaultTag():
+			report[i].Err = fmt.Errorf("%s is tagged, move it by hand", entry.Name)
+			continue
+		case balance <= MFEE:
+			report[i].Err = fmt.Errorf("balance of %s does not cover the fee", entry.Name)
+			continue
+		}
+		builder := TransactionBuilder{
+			Source:      keypair,
+			Balance:     balance,
+			Destination: w.Current(),
+			Change:      w.Address(w.Index + 1),
+			Amount:      balance - MFEE,
+			Fee:         MFEE,
+			Client:      c,
+		}
+		tx, err := builder.BuildContext(ctx)
+		if err != nil {
+			report[i].Err = err
+			continue
+		}
+		report[i].Tx = &tx
+	}
+	return report, nil
+}
@@ -0,0 +1,112 @@
+package go_mcminterface_test
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	mcm "github.com/NickP005/go_mcminterface"
+	"github.com/NickP005/go_mcminterface/mcmtest"
+)
+
+func TestReadLegacyFile(t *testing.T) {
+	dir := t.TempDir()
+	address := mcm.NewWotsKeypair([]byte("legacy")).Address()
+	binary_path := filepath.Join(dir, "maddr.dat")
+	hex_path := filepath.Join(dir, "export.txt")
+	wallet_path := filepath.Join(dir, "wallet.wal")
+	os.WriteFile(binary_path, address.Address[:], 0600)
+	os.WriteFile(hex_path, []byte(hex.EncodeToString(address.Address[:])+"\n"), 0600)
+	os.WriteFile(wallet_path, make([]byte, 4096), 0600)
+
+	for path, name := range map[string]string{binary_path: "maddr", hex_path: "export"} {
+		entry, err := mcm.ReadLegacyFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry.Address.Address != address.Address || entry.Name != name || entry.Secret != nil {
+			t.Errorf("%s: entry %q does not hold the address", path, entry.Name)
+		}
+	}
+	if _, err := mcm.ReadLegacyFile(wallet_path); !errors.Is(err, mcm.ErrLegacyWalletUnsupported) {
+		t.Errorf("wallet file: err = %v, want ErrLegacyWalletUnsupported", err)
+	}
+}
+
+func TestLegacyEntryKeypair(t *testing.T) {
+	keypair := mcm.NewWotsKeypair([]byte("legacy"))
+	entry := mcm.LegacyEntry{Address: keypair.Address(), Secret: keypair.PrivateSeed[:]}
+	signer, ok := entry.Keypair()
+	if !ok {
+		t.Fatal("secret does not generate the address")
+	}
+	if signer.Address() != keypair.Address() {
+		t.Error("keypair of the entry signs for another address")
+	}
+	entry.Secret = make([]byte, mcm.WOTS_N)
+	if _, ok := entry.Keypair(); ok {
+		t.Error("wrong secret accepted")
+	}
+	entry.Secret = nil
+	if _, ok := entry.Keypair(); ok {
+		t.Error("missing secret accepted")
+	}
+}
+
+func TestImportLegacy(t *testing.T) {
+	chain := mcmtest.NewChain()
+	client := mcmtest.NewTestNetwork(t, chain, chain, chain).Client(3)
+	wallet := mcm.NewWallet([]byte("master seed"), nil)
+	wallet.Client = client
+
+	funded := mcm.NewWotsKeypair([]byte("funded"))
+	no_secret := mcm.NewWotsKeypair([]byte("no secret"))
+	tagged := mcm.NewWotsKeypair([]byte("tagged"))
+	tagged_address := tagged.Address()
+	tagged_address.SetTAG([]byte("legacy tag.."))
+	chain.SetBalance(funded.Address(), 10000)
+	chain.SetBalance(no_secret.Address(), 2000)
+	chain.SetBalance(tagged_address, 3000)
+	entries := []mcm.LegacyEntry{
+		{Name: "funded", Address: funded.Address(), Secret: funded.PrivateSeed[:]},
+		{Name: "no secret", Address: no_secret.Address()},
+		{Name: "tagged", Address: tagged_address, Secret: tagged.PrivateSeed[:]},
+		{Name: "empty", Address: mcm.NewWotsKeypair([]byte("empty")).Address()},
+	}
+	balances := []uint64{10000, 2000, 3000, 0}
+
+	// the dry run only reports the balances
+	report, err := wallet.ImportLegacy(entries, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, migration := range report {
+		if migration.Balance != balances[i] || migration.Tx != nil || migration.Err != nil {
+			t.Errorf("dry run %s: balance %d, tx %v, err %v", migration.Entry.Name, migration.Balance, migration.Tx != nil, migration.Err)
+		}
+	}
+
+	report, err = wallet.ImportLegacy(entries, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := report[0].Tx
+	if tx == nil || report[0].Err != nil {
+		t.Fatalf("funded entry not moved: %v", report[0].Err)
+	}
+	if tx.Dst_addr != wallet.Current().Address || binary.LittleEndian.Uint64(tx.Send_total[:]) != 10000-mcm.MFEE {
+		t.Error("funded entry not moved to the wallet")
+	}
+	if report[1].Tx != nil || report[1].Err == nil {
+		t.Error("entry without secret moved")
+	}
+	if report[2].Tx != nil || report[2].Err == nil {
+		t.Error("tagged entry moved")
+	}
+	if report[3].Tx != nil || report[3].Err != nil {
+		t.Errorf("empty entry: tx %v, err %v", report[3].Tx != nil, report[3].Err)
+	}
+}
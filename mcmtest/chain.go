@@ -0,0 +1,415 @@
+package mcmtest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	mcm "github.com/NickP005/go_mcminterface"
+)
+
+// Chain is an in-memory blockchain and ledger served by one or more Nodes.
+// It is safe for concurrent use.
+type Chain struct {
+	mu        sync.RWMutex
+	blocks    [][]byte
+	candidate []byte
+	balances  map[[mcm.TXADDRLEN]byte]uint64
+	balances3 map[mcm.AddressV3]uint64 // v3 ledger, see AddNeoGenesisV3
+}
+
+// NewChain creates a chain holding only the genesis block, with an empty
+// ledger
+func NewChain() *Chain {
+	return NewChainWithLedger()
+}
+
+// NewChainWithLedger creates a chain holding only the genesis block, whose
+// ledger holds the addresses with their Amount
+func NewChainWithLedger(ledger ...mcm.WotsAddress) *Chain {
+	c := &Chain{
+		balances:  make(map[[mcm.TXADDRLEN]byte]uint64),
+		balances3: make(map[mcm.AddressV3]uint64),
+	}
+	for _, addr := range ledger {
+		c.balances[addr.Address] = addr.Amount
+	}
+	entries := c.ledger()
+	header := make([]byte, 4, 4+len(entries))
+	binary.LittleEndian.PutUint32(header, uint32(4+len(entries)))
+	var trailer mcm.BTRAILER
+	binary.LittleEndian.PutUint32(trailer.Stime[:], uint32(time.Now().Unix()))
+	c.blocks = append(c.blocks, sealBlock(append(header, entries...), nil, trailer))
+	return c
+}
+
+// pseudoHeader is the header of a block without body
+func pseudoHeader() []byte {
+	hdrlen := make([]byte, 4)
+	binary.LittleEndian.PutUint32(hdrlen, 4)
+	return hdrlen
+}
+
+// sealBlock joins header, body and trailer and sets the block hash
+func sealBlock(header []byte, body []mcm.TXQENTRY, trailer mcm.BTRAILER) []byte {
+	bytes := append([]byte{}, header...)
+	for _, tx := range body {
+		bytes = append(bytes, tx.GetBytes()...)
+	}
+	bytes = append(bytes, trailer.GetBytes()...)
+	return sealBytes(bytes)
+}
+
+// sealBytes sets the block hash at the end of the block bytes
+func sealBytes(bytes []byte) []byte {
+	bhash := sha256.Sum256(bytes[:len(bytes)-mcm.HASHLEN])
+	copy(bytes[len(bytes)-mcm.HASHLEN:], bhash[:])
+	return bytes
+}
+
+// nextTrailer prepares the trailer of the block following the current tip
+func (c *Chain) nextTrailer(tcount int) mcm.BTRAILER {
+	prev := c.blocks[len(c.blocks)-1]
+	prev_trailer := prev[len(prev)-mcm.BTRAILER_LEN:]
+
+	var trailer mcm.BTRAILER
+	copy(trailer.Phash[:], prev_trailer[128:160])
+	binary.LittleEndian.PutUint64(trailer.Bnum[:], uint64(len(c.blocks)))
+	binary.LittleEndian.PutUint64(trailer.Mfee[:], 500)
+	binary.LittleEndian.PutUint32(trailer.Tcount[:], uint32(tcount))
+	copy(trailer.Time0[:], prev_trailer[124:128])
+	binary.LittleEndian.PutUint32(trailer.Stime[:], binary.LittleEndian.Uint32(trailer.Time0[:])+56)
+	return trailer
+}
+
+// buildBlock mines a block holding body on top of the chain
+func (c *Chain) buildBlock(body []mcm.TXQENTRY) []byte {
+	block := mcm.Block{
+		Header:  mcm.BHEADER{Hdrlen: 2220, Mreward: 5000000000},
+		Body:    body,
+		Trailer: c.nextTrailer(len(body)),
+	}
+	block.Trailer.Mroot = block.MerkleRoot()
+
+	return sealBlock(block.Header.GetBytes(), body, block.Trailer)
+}
+
+// AddBlock mines a block holding body on top of the chain and returns it.
+// The ledger follows the transactions: sources are removed, destinations
+// and change addresses credited. The balances are not checked.
+// Mined blocks hold at least one transaction, AddBlock panics on an empty
+// body: see AddPseudoBlock.
+func (c *Chain) AddBlock(body []mcm.TXQENTRY) mcm.Block {
+	if len(body) == 0 {
+		panic("mcmtest: AddBlock without transactions, see AddPseudoBlock")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	bytes := c.buildBlock(body)
+	c.blocks = append(c.blocks, bytes)
+	c.candidate = nil
+	for _, tx := range body {
+		delete(c.balances, tx.Src_addr)
+		c.balances[tx.Dst_addr] += binary.LittleEndian.Uint64(tx.Send_total[:])
+		if change := binary.LittleEndian.Uint64(tx.Change_total[:]); change > 0 {
+			c.balances[tx.Chg_addr] += change
+		}
+	}
+	return mcm.BlockFromBytes(bytes)
+}
+
+// SetCandidate sets the candidate block sent on OP_GET_CBLOCK: a block holding
+// body on top of the chain, without nonce. It is cleared when a block is added.
+// Like AddBlock, it panics on an empty body.
+func (c *Chain) SetCandidate(body []mcm.TXQENTRY) mcm.Block {
+	if len(body) == 0 {
+		panic("mcmtest: SetCandidate without transactions")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	bytes := c.buildBlock(body)
+	// the candidate is not solved yet
+	copy(bytes[len(bytes)-mcm.HASHLEN:], make([]byte, mcm.HASHLEN))
+	c.candidate = bytes
+	return mcm.BlockFromBytes(bytes)
+}
+
+// Candidate returns the candidate block bytes, if any
+func (c *Chain) Candidate() ([]byte, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.candidate, c.candidate != nil
+}
+
+// AddPseudoBlock appends a block without transactions
+func (c *Chain) AddPseudoBlock() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.blocks = append(c.blocks, sealBlock(pseudoHeader(), nil, c.nextTrailer(0)))
+	c.candidate = nil
+}
+
+// AddNeoGenesis appends pseudo-blocks up to the next multiple of 256, then
+// the neo-genesis block holding the current ledger, and returns it
+func (c *Chain) AddNeoGenesis() mcm.Block {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for len(c.blocks)&0xff != 0 {
+		c.blocks = append(c.blocks, sealBlock(pseudoHeader(), nil, c.nextTrailer(0)))
+	}
+	ledger := c.ledger()
+	header := make([]byte, 4, 4+len(ledger))
+	binary.LittleEndian.PutUint32(header, uint32(4+len(ledger)))
+	bytes := sealBlock(append(header, ledger...), nil, c.nextTrailer(0))
+	c.blocks = append(c.blocks, bytes)
+	c.candidate = nil
+	return mcm.BlockFromBytes(bytes)
+}
+
+// AddNeoGenesisV3 appends pseudo-blocks up to the next multiple of 256, then
+// a v3 neo-genesis block holding the v3 ledger set by SetBalanceV3, and
+// returns it. The blocks following it are added with AddBlockV3.
+func (c *Chain) AddNeoGenesisV3() mcm.BlockV3 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for len(c.blocks)&0xff != 0 {
+		c.blocks = append(c.blocks, sealBlock(pseudoHeader(), nil, c.nextTrailer(0)))
+	}
+	block := mcm.BlockV3{
+		Header:  mcm.BHEADERV3{Hdrlen: 4},
+		Ledger:  c.ledgerV3(),
+		Trailer: c.nextTrailer(0),
+	}
+	block.Header.Hdrlen += uint32(len(block.Ledger) * mcm.LENTRY_V3_LEN)
+	bytes := sealBytes(block.GetBytes())
+	c.blocks = append(c.blocks, bytes)
+	c.candidate = nil
+	block, _ = mcm.BlockV3FromBytes(bytes)
+	return block
+}
+
+// AddBlockV3 mines a v3 block holding body on top of the chain and returns
+// it. The v3 ledger follows the transactions: sources are removed,
+// destinations credited by tag (the implicit address of the tag if no
+// address holds it) and change addresses credited. The balances are not
+// checked. Like AddBlock, it panics on an empty body.
+func (c *Chain) AddBlockV3(body []mcm.TransactionV3) mcm.BlockV3 {
+	if len(body) == 0 {
+		panic("mcmtest: AddBlockV3 without transactions, see AddPseudoBlock")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	block := mcm.BlockV3{
+		Header:  mcm.BHEADERV3{Hdrlen: mcm.BHEADER_V3_LEN, Mreward: 5000000000},
+		Body:    body,
+		Trailer: c.nextTrailer(len(body)),
+	}
+	bytes := sealBytes(block.GetBytes())
+	c.blocks = append(c.blocks, bytes)
+	c.candidate = nil
+	for _, tx := range body {
+		delete(c.balances3, tx.Src_addr)
+		for _, dst := range tx.Destinations {
+			c.balances3[c.resolveV3(dst.Tag)] += binary.LittleEndian.Uint64(dst.Amount[:])
+		}
+		if change := binary.LittleEndian.Uint64(tx.Change_total[:]); change > 0 {
+			c.balances3[tx.Chg_addr] += change
+		}
+	}
+	block, _ = mcm.BlockV3FromBytes(bytes)
+	return block
+}
+
+// resolveV3 returns the v3 address holding tag, or the implicit address of tag
+func (c *Chain) resolveV3(tag [mcm.ADDR_TAG_LEN]byte) mcm.AddressV3 {
+	for address := range c.balances3 {
+		if string(address.Tag()) == string(tag[:]) {
+			return address
+		}
+	}
+	var address mcm.AddressV3
+	copy(address[:mcm.ADDR_TAG_LEN], tag[:])
+	copy(address[mcm.ADDR_TAG_LEN:], tag[:])
+	return address
+}
+
+// AddBlockBytes appends raw block bytes as they are, to script malformed blocks
+func (c *Chain) AddBlockBytes(bytes []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.blocks = append(c.blocks, append([]byte{}, bytes...))
+	c.candidate = nil
+}
+
+// AddMinedBlock appends a block mined by a client, if it follows the chain
+// and its hash is right
+func (c *Chain) AddMinedBlock(bytes []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(bytes) < 4+mcm.BTRAILER_LEN {
+		return fmt.Errorf("block too short: %d bytes", len(bytes))
+	}
+	block := mcm.BlockFromBytes(bytes)
+	tip := mcm.BlockFromBytes(c.blocks[len(c.blocks)-1]).Trailer
+	if binary.LittleEndian.Uint64(block.Trailer.Bnum[:]) != uint64(len(c.blocks)) {
+		return fmt.Errorf("block %d does not follow block %d", binary.LittleEndian.Uint64(block.Trailer.Bnum[:]), len(c.blocks)-1)
+	}
+	if block.Trailer.Phash != tip.Bhash {
+		return fmt.Errorf("previous hash mismatch")
+	}
+	if sha256.Sum256(bytes[:len(bytes)-mcm.HASHLEN]) != block.Trailer.Bhash {
+		return fmt.Errorf("block hash mismatch")
+	}
+	c.blocks = append(c.blocks, append([]byte{}, bytes...))
+	c.candidate = nil
+	return nil
+}
+
+// Height returns the number of the latest block
+func (c *Chain) Height() uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return uint64(len(c.blocks) - 1)
+}
+
+// BlockBytes returns the bytes of block bnum
+func (c *Chain) BlockBytes(bnum uint64) ([]byte, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if bnum >= uint64(len(c.blocks)) {
+		return nil, false
+	}
+	return c.blocks[bnum], true
+}
+
+// BlockHash returns the hash of block bnum
+func (c *Chain) BlockHash(bnum uint64) ([mcm.HASHLEN]byte, bool) {
+	var hash [mcm.HASHLEN]byte
+	bytes, ok := c.BlockBytes(bnum)
+	if !ok {
+		return hash, false
+	}
+	copy(hash[:], bytes[len(bytes)-mcm.HASHLEN:])
+	return hash, true
+}
+
+// Trailers returns the trailers of up to count blocks starting from start
+func (c *Chain) Trailers(start uint64, count uint64) []byte {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var trailers []byte
+	for bnum := start; bnum < start+count && bnum < uint64(len(c.blocks)); bnum++ {
+		block := c.blocks[bnum]
+		trailers = append(trailers, block[len(block)-mcm.BTRAILER_LEN:]...)
+	}
+	return trailers
+}
+
+// SetBalance sets the balance of addr in the ledger
+func (c *Chain) SetBalance(addr mcm.WotsAddress, amount uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.balances[addr.Address] = amount
+}
+
+// RemoveAddress deletes addr from the ledger
+func (c *Chain) RemoveAddress(addr mcm.WotsAddress) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.balances, addr.Address)
+}
+
+// SetBalanceV3 sets the balance of addr in the v3 ledger
+func (c *Chain) SetBalanceV3(addr mcm.AddressV3, amount uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.balances3[addr] = amount
+}
+
+// BalanceV3 returns the balance of addr and whether it is in the v3 ledger
+func (c *Chain) BalanceV3(addr mcm.AddressV3) (uint64, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	balance, ok := c.balances3[addr]
+	return balance, ok
+}
+
+// Balance returns the balance of addr and whether it is in the ledger
+func (c *Chain) Balance(addr mcm.WotsAddress) (uint64, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	balance, ok := c.balances[addr.Address]
+	return balance, ok
+}
+
+// Resolve returns the ledger address holding tag
+func (c *Chain) Resolve(tag []byte) (mcm.WotsAddress, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for address, balance := range c.balances {
+		if string(address[mcm.TXADDRLEN-mcm.TXTAGLEN:]) == string(tag) {
+			addr := mcm.WotsAddressFromBytes(address[:])
+			addr.Amount = balance
+			return addr, true
+		}
+	}
+	return mcm.WotsAddress{}, false
+}
+
+// Ledger returns the ledger in the node format: entries sorted by address
+func (c *Chain) Ledger() []byte {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.ledger()
+}
+
+func (c *Chain) ledger() []byte {
+	addresses := make([][mcm.TXADDRLEN]byte, 0, len(c.balances))
+	for address := range c.balances {
+		addresses = append(addresses, address)
+	}
+	sort.Slice(addresses, func(i, j int) bool {
+		return bytes.Compare(addresses[i][:], addresses[j][:]) < 0
+	})
+	ledger := make([]byte, 0, len(addresses)*mcm.LENTRY_LEN)
+	for _, address := range addresses {
+		ledger = append(ledger, address[:]...)
+		ledger = binary.LittleEndian.AppendUint64(ledger, c.balances[address])
+	}
+	return ledger
+}
+
+// ledgerV3 returns the v3 ledger entries sorted by address
+func (c *Chain) ledgerV3() []mcm.LedgerEntryV3 {
+	entries := make([]mcm.LedgerEntryV3, 0, len(c.balances3))
+	for address, balance := range c.balances3 {
+		entries = append(entries, mcm.LedgerEntryV3{Address: address, Amount: balance})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i].Address[:], entries[j].Address[:]) < 0
+	})
+	return entries
+}
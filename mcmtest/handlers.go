@@ -0,0 +1,136 @@
+package mcmtest
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"net"
+
+	mcm "github.com/NickP005/go_mcminterface"
+)
+
+// defaultHandlers answer like a mainnet node would
+var defaultHandlers = map[uint16]Handler{
+	mcm.OP_HELLO:      handleHello,
+	mcm.OP_GET_IPL:    handleGetIPL,
+	mcm.OP_BALANCE:    handleBalance,
+	mcm.OP_RESOLVE:    handleResolve,
+	mcm.OP_HASH:       handleHash,
+	mcm.OP_TF:         handleTF,
+	mcm.OP_GET_BLOCK:  handleGetBlock,
+	mcm.OP_GET_TFILE:  handleGetTFile,
+	mcm.OP_GET_CBLOCK: handleGetCBlock,
+	mcm.OP_MBLOCK:     handleMBlock,
+	mcm.OP_TX:         handleTX,
+	mcm.OP_IDENTIFY:   handleIdentify,
+}
+
+func handleHello(c *Conn, req mcm.TX) error {
+	rand.Read(c.id2[:])
+	return c.Send(mcm.OP_HELLO_ACK, nil)
+}
+
+func handleGetIPL(c *Conn, req mcm.TX) error {
+	c.node.mu.Lock()
+	ips := append([]string{}, c.node.ips...)
+	c.node.mu.Unlock()
+
+	var list []byte
+	for _, ip := range ips {
+		if ip4 := net.ParseIP(ip).To4(); ip4 != nil && len(list) < 252 {
+			list = append(list, ip4...)
+		}
+	}
+	return c.Send(mcm.OP_SEND_IPL, func(tx *mcm.TX) {
+		binary.LittleEndian.PutUint16(tx.Len[:], uint16(len(list)))
+		copy(tx.Src_addr[:], list)
+	})
+}
+
+func handleBalance(c *Conn, req mcm.TX) error {
+	balance, found := c.node.Chain.Balance(mcm.WotsAddressFromBytes(req.Src_addr[:]))
+	return c.Send(mcm.OP_SEND_BAL, func(tx *mcm.TX) {
+		tx.Src_addr = req.Src_addr
+		if found {
+			binary.LittleEndian.PutUint64(tx.Send_total[:], balance)
+			tx.Change_total[0] = 1
+		}
+	})
+}
+
+func handleResolve(c *Conn, req mcm.TX) error {
+	addr, found := c.node.Chain.Resolve(req.Dst_addr[mcm.TXADDRLEN-mcm.TXTAGLEN:])
+	return c.Send(mcm.OP_RESOLVE, func(tx *mcm.TX) {
+		tx.Dst_addr = req.Dst_addr
+		if found {
+			tx.Send_total[0] = 1
+			tx.Dst_addr = addr.Address
+			binary.LittleEndian.PutUint64(tx.Change_total[:], addr.Amount)
+		}
+	})
+}
+
+func handleHash(c *Conn, req mcm.TX) error {
+	hash, found := c.node.Chain.BlockHash(binary.LittleEndian.Uint64(req.Blocknum[:]))
+	if !found {
+		return c.Send(mcm.OP_NACK, nil)
+	}
+	return c.Send(mcm.OP_HASH, func(tx *mcm.TX) {
+		tx.Blocknum = req.Blocknum
+		copy(tx.Src_addr[:], hash[:])
+	})
+}
+
+func handleTF(c *Conn, req mcm.TX) error {
+	start := binary.LittleEndian.Uint32(req.Blocknum[:4])
+	count := binary.LittleEndian.Uint32(req.Blocknum[4:])
+	if count > 1000 {
+		return c.Send(mcm.OP_NACK, nil)
+	}
+	return c.SendFile(c.node.Chain.Trailers(uint64(start), uint64(count)))
+}
+
+func handleGetBlock(c *Conn, req mcm.TX) error {
+	block, found := c.node.Chain.BlockBytes(binary.LittleEndian.Uint64(req.Blocknum[:]))
+	if !found {
+		return c.Send(mcm.OP_NACK, nil)
+	}
+	return c.SendFile(block)
+}
+
+func handleGetTFile(c *Conn, req mcm.TX) error {
+	chain := c.node.Chain
+	return c.SendFile(chain.Trailers(0, chain.Height()+1))
+}
+
+func handleGetCBlock(c *Conn, req mcm.TX) error {
+	candidate, found := c.node.Chain.Candidate()
+	if !found {
+		return c.Send(mcm.OP_NACK, nil)
+	}
+	return c.SendFile(candidate)
+}
+
+// handleMBlock receives a mined block and adds it to the chain if it follows
+// it. Nothing is answered, a node announces new blocks to its peers only.
+func handleMBlock(c *Conn, req mcm.TX) error {
+	block, err := c.RecvFile()
+	if err != nil {
+		return err
+	}
+	c.node.Chain.AddMinedBlock(block)
+	return nil
+}
+
+func handleTX(c *Conn, req mcm.TX) error {
+	c.node.mu.Lock()
+	defer c.node.mu.Unlock()
+
+	c.node.received = append(c.node.received, req)
+	return nil
+}
+
+// handleIdentify answers with a bare header, which carries the version and
+// the latest block of the node
+func handleIdentify(c *Conn, req mcm.TX) error {
+	return c.Send(mcm.OP_IDENTIFY, nil)
+}
@@ -0,0 +1,107 @@
+package mcmtest
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+
+	mcm "github.com/NickP005/go_mcminterface"
+)
+
+// Network is a set of nodes reachable through fake IPs, to test the quorum
+// logic of the queries
+type Network struct {
+	mu    sync.Mutex
+	nodes map[string]*Node
+}
+
+// NewNetwork creates an empty network
+func NewNetwork() *Network {
+	return &Network{nodes: make(map[string]*Node)}
+}
+
+// AddNode starts a node serving chain reachable as ip
+func (nw *Network) AddNode(ip string, chain *Chain) (*Node, error) {
+	node, err := NewNode(chain)
+	if err != nil {
+		return nil, err
+	}
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+
+	nw.nodes[ip] = node
+	return node, nil
+}
+
+// NewTestNetwork starts a network of len(chains) nodes for the test t, node
+// i serving chains[i] as 10.0.0.<i+1>. The network is closed when the test
+// ends.
+func NewTestNetwork(t testing.TB, chains ...*Chain) *Network {
+	t.Helper()
+	nw := NewNetwork()
+	t.Cleanup(func() { nw.Close() })
+	for i, chain := range chains {
+		if _, err := nw.AddNode(fmt.Sprintf("10.0.0.%d", i+1), chain); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return nw
+}
+
+// Node returns the node reachable as ip
+func (nw *Network) Node(ip string) *Node {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+
+	return nw.nodes[ip]
+}
+
+// Close stops every node of the network
+func (nw *Network) Close() error {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+
+	var first error
+	for _, node := range nw.nodes {
+		if err := node.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// DialContext routes address to the node registered with its host, so that
+// the network can be used as the Dialer of a mcm.Client
+func (nw *Network) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	node := nw.Node(host)
+	if node == nil {
+		return nil, fmt.Errorf("dial %s: connection refused", address)
+	}
+	return node.DialContext(ctx, network, address)
+}
+
+// Client returns a client querying query_size nodes of the network
+func (nw *Network) Client(query_size int) *mcm.Client {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+
+	settings := mcm.SettingsType{
+		QuerySize:        query_size,
+		QueryTimeout:     5,
+		MaxQueryAttempts: 3,
+	}
+	for ip := range nw.nodes {
+		settings.StartIPs = append(settings.StartIPs, ip)
+		settings.IPs = append(settings.IPs, ip)
+		settings.Nodes = append(settings.Nodes, mcm.RemoteNode{IP: ip, Ping: 100})
+	}
+	client := mcm.NewClient(settings)
+	client.Dialer = nw
+	return client
+}
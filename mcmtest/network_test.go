@@ -0,0 +1,375 @@
+package mcmtest
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	mcm "github.com/NickP005/go_mcminterface"
+)
+
+func testAddress(seed string) mcm.WotsAddress {
+	return mcm.NewWotsKeypair([]byte(seed)).Address()
+}
+
+// signedTransaction moves amount from the address of seed src, holding
+// balance, to dst
+func signedTransaction(t *testing.T, src string, balance uint64, dst mcm.WotsAddress, amount uint64) mcm.TXQENTRY {
+	t.Helper()
+	builder := mcm.TransactionBuilder{
+		Source:      mcm.NewWotsKeypair([]byte(src)),
+		Balance:     balance,
+		Destination: dst,
+		Change:      testAddress(src + " change"),
+		Amount:      amount,
+	}
+	tx, err := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := mcm.TXQENTRY{
+		Src_addr:     tx.Src_addr,
+		Dst_addr:     tx.Dst_addr,
+		Chg_addr:     tx.Chg_addr,
+		Send_total:   tx.Send_total,
+		Change_total: tx.Change_total,
+		Tx_fee:       tx.Tx_fee,
+		Tx_sig:       tx.Tx_sig,
+	}
+	entry.Tx_id = sha256.Sum256(entry.Src_addr[:])
+	return entry
+}
+
+func TestQueryBalance(t *testing.T) {
+	chain := NewChain()
+	addr := testAddress("funded")
+	chain.SetBalance(addr, 1234)
+	client := NewTestNetwork(t, chain, chain, chain).Client(3)
+
+	balance, err := client.QueryBalance(hex.EncodeToString(addr.Address[:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance != 1234 {
+		t.Errorf("balance = %d, want 1234", balance)
+	}
+
+	empty := testAddress("empty")
+	_, err = client.QueryBalance(hex.EncodeToString(empty.Address[:]))
+	if !errors.Is(err, mcm.ErrAddressNotFound) {
+		t.Errorf("unknown address: err = %v, want ErrAddressNotFound", err)
+	}
+}
+
+func TestQueryBalanceQuorum(t *testing.T) {
+	addr := testAddress("funded")
+	honest := NewChain()
+	honest.SetBalance(addr, 1000)
+	lying := NewChain()
+	lying.SetBalance(addr, 9999)
+
+	// a lying node is outvoted
+	client := NewTestNetwork(t, honest, honest, lying).Client(3)
+	balance, err := client.QueryBalance(hex.EncodeToString(addr.Address[:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance != 1000 {
+		t.Errorf("balance = %d, want 1000", balance)
+	}
+
+	// no answer reaches 2 votes of 3
+	other := NewChain()
+	other.SetBalance(addr, 5)
+	client = NewTestNetwork(t, honest, lying, other).Client(3)
+	_, err = client.QueryBalance(hex.EncodeToString(addr.Address[:]))
+	var no_quorum *mcm.ErrNoQuorum
+	if !errors.As(err, &no_quorum) {
+		t.Fatalf("err = %v, want *ErrNoQuorum", err)
+	}
+	if no_quorum.Votes != 1 || no_quorum.Needed != 2 {
+		t.Errorf("votes %d of %d needed, want 1 of 2", no_quorum.Votes, no_quorum.Needed)
+	}
+}
+
+func TestBusyNodeRetried(t *testing.T) {
+	chain := NewChain()
+	addr := testAddress("funded")
+	chain.SetBalance(addr, 42)
+	network := NewTestNetwork(t, chain, chain, chain)
+
+	// the first request is answered OP_BUSY, the retry normally
+	var requests atomic.Int32
+	network.Node("10.0.0.1").Handle(mcm.OP_BALANCE, func(c *Conn, req mcm.TX) error {
+		if requests.Add(1) == 1 {
+			return c.Send(mcm.OP_BUSY, nil)
+		}
+		return handleBalance(c, req)
+	})
+
+	client := network.Client(3)
+	balance, err := client.QueryBalance(hex.EncodeToString(addr.Address[:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance != 42 {
+		t.Errorf("balance = %d, want 42", balance)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("busy node got %d requests, want 2", n)
+	}
+}
+
+func TestQueryBlockFromNumber(t *testing.T) {
+	chain := NewChain()
+	chain.AddPseudoBlock()
+	want := chain.AddBlock([]mcm.TXQENTRY{signedTransaction(t, "source", 10000, testAddress("dst"), 1000)})
+	client := NewTestNetwork(t, chain, chain, chain).Client(3)
+
+	block, err := client.QueryBlockFromNumber(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.Trailer != want.Trailer {
+		t.Errorf("trailer of block 2 differs from the chain")
+	}
+	if err := block.ValidateTransactions(); err != nil {
+		t.Error(err)
+	}
+
+	trailers, err := client.QueryBTrailers(0, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mcm.ValidateTrailerChain(trailers); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSyncFromSnapshot(t *testing.T) {
+	chain := NewChain()
+	chain.SetBalance(testAddress("source"), 10000)
+	chain.AddNeoGenesis()
+	chain.AddBlock([]mcm.TXQENTRY{signedTransaction(t, "source", 10000, testAddress("dst"), 1000)})
+	chain.AddPseudoBlock()
+	client := NewTestNetwork(t, chain, chain, chain).Client(3)
+
+	snapshot, err := client.SyncFromSnapshot(filepath.Join(t.TempDir(), "tfile.dat"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.Block != 258 {
+		t.Errorf("snapshot of block %d, want 258", snapshot.Block)
+	}
+	if _, found := snapshot.Ledger.Balance(testAddress("source")); found {
+		t.Error("spent source still in the ledger")
+	}
+	for seed, want := range map[string]uint64{"dst": 1000, "source change": 8500} {
+		if balance, _ := snapshot.Ledger.Balance(testAddress(seed)); balance != want {
+			t.Errorf("balance of %q = %d, want %d", seed, balance, want)
+		}
+	}
+}
+
+func TestSyncFromSnapshotYoungChain(t *testing.T) {
+	source := testAddress("source")
+	source.Amount = 10000
+	chain := NewChainWithLedger(source)
+	chain.AddBlock([]mcm.TXQENTRY{signedTransaction(t, "source", 10000, testAddress("dst"), 1000)})
+	chain.AddPseudoBlock()
+	client := NewTestNetwork(t, chain, chain, chain).Client(3)
+
+	// below 256 blocks the snapshot is the genesis block, not the latest one
+	snapshot, err := client.SyncFromSnapshot(filepath.Join(t.TempDir(), "tfile.dat"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.Block != 2 || snapshot.Hash != mustHash(chain, 2) {
+		t.Errorf("snapshot of block %d, want 2", snapshot.Block)
+	}
+	if _, found := snapshot.Ledger.Balance(source); found {
+		t.Error("spent source still in the ledger")
+	}
+	for seed, want := range map[string]uint64{"dst": 1000, "source change": 8500} {
+		if balance, _ := snapshot.Ledger.Balance(testAddress(seed)); balance != want {
+			t.Errorf("balance of %q = %d, want %d", seed, balance, want)
+		}
+	}
+
+	genesis, err := client.QueryGenesisBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if genesis.Trailer.Bhash != mustHash(chain, 0) || len(genesis.Ledger) != 1 || genesis.Ledger[0].Amount != 10000 {
+		t.Error("QueryGenesisBlock did not return the genesis block")
+	}
+}
+
+func mustHash(chain *Chain, bnum uint64) [mcm.HASHLEN]byte {
+	hash, _ := chain.BlockHash(bnum)
+	return hash
+}
+
+func TestIdentify(t *testing.T) {
+	chain := NewChain()
+	chain.AddPseudoBlock()
+	network := NewTestNetwork(t, chain)
+	network.Node("10.0.0.1").SetVersion(4, mcm.CPUSH|mcm.CSANCTUARY)
+
+	sd, err := network.Client(1).ConnectToNodeContext(context.Background(), "10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sd.Close()
+	identity, err := sd.Identify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.IP != "10.0.0.1" || identity.ProtocolVersion != 4 || identity.BlockNum != 1 {
+		t.Errorf("identity = %+v", identity)
+	}
+	if !identity.HasCapability(mcm.CSANCTUARY) || identity.HasCapability(mcm.CWALLET) {
+		t.Errorf("capabilities = %b", identity.Capabilities)
+	}
+	hash, _ := chain.BlockHash(1)
+	if identity.BlockHash != hash {
+		t.Error("block hash differs from the chain")
+	}
+}
+
+func TestQueryNodeIdentities(t *testing.T) {
+	chain := NewChain()
+	network := NewTestNetwork(t, chain, chain, chain)
+	network.Node("10.0.0.3").SetVersion(3, 0)
+	client := network.Client(3)
+
+	identities, err := client.QueryNodeIdentities()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(identities) != 3 {
+		t.Fatalf("%d identities, want 3", len(identities))
+	}
+	spread := mcm.VersionSpread(client.Nodes())
+	if spread[4] != 2 || spread[3] != 1 {
+		t.Errorf("version spread = %v, want 2 nodes of version 4 and 1 of version 3", spread)
+	}
+}
+
+func TestPickNodesPrefersNewest(t *testing.T) {
+	chain := NewChain()
+	network := NewTestNetwork(t, chain, chain, chain)
+	network.Node("10.0.0.3").SetVersion(3, 0)
+	client := network.Client(3)
+	if _, err := client.QueryNodeIdentities(); err != nil {
+		t.Fatal(err)
+	}
+
+	// with equal pings the outdated node weighs 0.25 against 1 and 1: 1 pick
+	// in 9, against 1 in 3 without the preference
+	const picks = 3000
+	outdated := 0
+	for i := 0; i < picks; i++ {
+		if client.PickNodes(1)[0].IP == "10.0.0.3" {
+			outdated++
+		}
+	}
+	if outdated > picks/5 {
+		t.Errorf("outdated node picked %d times in %d", outdated, picks)
+	}
+}
+
+func TestOversizedFilePacket(t *testing.T) {
+	chain := NewChain()
+	chain.AddPseudoBlock()
+	network := NewTestNetwork(t, chain)
+	// a packet claiming more bytes than a TX holds
+	network.Node("10.0.0.1").Handle(mcm.OP_GET_BLOCK, func(c *Conn, req mcm.TX) error {
+		return c.Send(mcm.OP_SEND_FILE, func(tx *mcm.TX) {
+			binary.LittleEndian.PutUint16(tx.Len[:], 65000)
+		})
+	})
+
+	sd, err := network.Client(1).ConnectToNodeContext(context.Background(), "10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sd.Close()
+	if _, err := sd.GetBlockBytes(1); !errors.Is(err, mcm.ErrBadPacket) {
+		t.Errorf("err = %v, want ErrBadPacket", err)
+	}
+}
+
+func TestQueryCandidateBlock(t *testing.T) {
+	chain := NewChain()
+	chain.AddPseudoBlock()
+	want := chain.SetCandidate([]mcm.TXQENTRY{signedTransaction(t, "source", 10000, testAddress("dst"), 1000)})
+	network := NewTestNetwork(t, chain)
+	client := network.Client(1)
+
+	block, err := client.QueryCandidateBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.Trailer.Bnum != want.Trailer.Bnum || len(block.Body) != 1 || block.Body[0] != want.Body[0] {
+		t.Errorf("candidate block differs from the one of the node")
+	}
+
+	// a malformed candidate is reported as such
+	network.Node("10.0.0.1").Handle(mcm.OP_GET_CBLOCK, func(c *Conn, req mcm.TX) error {
+		return c.SendFile(make([]byte, 300))
+	})
+	_, err = client.QueryCandidateBlock()
+	if err == nil || !strings.Contains(err.Error(), "malformed block") {
+		t.Errorf("err = %v, want a malformed block", err)
+	}
+}
+
+// minedBlock solves the candidate block of chain holding body
+func minedBlock(chain *Chain, body []mcm.TXQENTRY) mcm.Block {
+	block := chain.SetCandidate(body)
+	bytes := block.GetBytes()
+	block.Trailer.Bhash = sha256.Sum256(bytes[:len(bytes)-mcm.HASHLEN])
+	return block
+}
+
+func TestSubmitMinedBlock(t *testing.T) {
+	chain := NewChain()
+	chain.AddPseudoBlock()
+	network := NewTestNetwork(t, chain, chain)
+	client := network.Client(2)
+	client.Settings.QueryTimeout = 2
+
+	block := minedBlock(chain, []mcm.TXQENTRY{signedTransaction(t, "source", 10000, testAddress("dst"), 1000)})
+	report, err := client.SubmitMinedBlock(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, submission := range report {
+		if !submission.Sent || !submission.Accepted {
+			t.Errorf("%s: %+v", submission.IP, submission)
+		}
+	}
+	if hash, _ := chain.BlockHash(2); chain.Height() != 2 || hash != block.Trailer.Bhash {
+		t.Error("mined block not added to the chain")
+	}
+
+	// a block with a wrong hash is sent but never adopted
+	bad := minedBlock(chain, []mcm.TXQENTRY{signedTransaction(t, "other", 10000, testAddress("dst"), 1000)})
+	bad.Trailer.Bhash[0] ^= 1
+	report, err = client.SubmitMinedBlock(bad)
+	if err == nil {
+		t.Fatal("bad block adopted")
+	}
+	for _, submission := range report {
+		if !submission.Sent || submission.Accepted || submission.Err == nil {
+			t.Errorf("%s: %+v", submission.IP, submission)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+// Package mcmtest runs in-process MCM nodes speaking the 8920 bytes TX
+// protocol, backed by a scriptable in-memory chain and ledger, so that the
+// queries of go_mcminterface can be exercised without live nodes.
+package mcmtest
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	mcm "github.com/NickP005/go_mcminterface"
+	"github.com/sigurn/crc16"
+)
+
+// Handler answers a request received after the handshake. The connection is
+// closed when it returns.
+type Handler func(conn *Conn, req mcm.TX) error
+
+// Conn is the node side of a client connection
+type Conn struct {
+	node *Node
+	conn net.Conn
+	id2  [2]byte
+}
+
+// Node is an MCM node listening on 127.0.0.1
+type Node struct {
+	Chain *Chain
+
+	mu       sync.Mutex
+	ips      []string
+	pversion byte
+	caps     byte
+	handlers map[uint16]Handler
+	received []mcm.TX
+	listener net.Listener
+	wg       sync.WaitGroup
+}
+
+// NewNode starts a node serving chain
+func NewNode(chain *Chain) (*Node, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	n := &Node{
+		Chain:    chain,
+		pversion: mcm.PVERSION,
+		handlers: make(map[uint16]Handler),
+		listener: listener,
+	}
+	n.wg.Add(1)
+	go n.serve()
+	return n, nil
+}
+
+// Addr returns the host:port the node listens on
+func (n *Node) Addr() string {
+	return n.listener.Addr().String()
+}
+
+// Close stops the node and waits for the open connections to end
+func (n *Node) Close() error {
+	err := n.listener.Close()
+	n.wg.Wait()
+	return err
+}
+
+// SetIPs sets the peer list sent on OP_GET_IPL
+func (n *Node) SetIPs(ips []string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.ips = append([]string{}, ips...)
+}
+
+// SetVersion sets the protocol version and capability flags sent in the
+// Version of every answer
+func (n *Node) SetVersion(pversion byte, capabilities byte) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.pversion = pversion
+	n.caps = capabilities
+}
+
+// Handle replaces the behaviour of the node for op. OP_HELLO can be handled
+// too, to script failed handshakes.
+func (n *Node) Handle(op uint16, handler Handler) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.handlers[op] = handler
+}
+
+// Received returns the transactions received with OP_TX
+func (n *Node) Received() []mcm.TX {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return append([]mcm.TX{}, n.received...)
+}
+
+// DialContext connects to the node whatever the address, so that a node can
+// be used as the Dialer of a mcm.Client
+func (n *Node) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, "tcp", n.Addr())
+}
+
+func (n *Node) serve() {
+	defer n.wg.Done()
+	for {
+		conn, err := n.listener.Accept()
+		if err != nil {
+			return
+		}
+		n.wg.Add(1)
+		go func() {
+			defer n.wg.Done()
+			defer conn.Close()
+			n.serveConn(conn)
+		}()
+	}
+}
+
+func (n *Node) handler(op uint16) Handler {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if handler, ok := n.handlers[op]; ok {
+		return handler
+	}
+	return defaultHandlers[op]
+}
+
+// serveConn handles the handshake and a single request, as MCM nodes do
+func (n *Node) serveConn(conn net.Conn) {
+	c := &Conn{node: n, conn: conn}
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	for _, expect_hello := range []bool{true, false} {
+		req, err := c.Recv()
+		if err != nil {
+			return
+		}
+		op := Opcode(req)
+		if expect_hello != (op == mcm.OP_HELLO) {
+			c.Send(mcm.OP_NACK, nil)
+			return
+		}
+		handler := n.handler(op)
+		if handler == nil {
+			c.Send(mcm.OP_NACK, nil)
+			return
+		}
+		if handler(c, req) != nil {
+			return
+		}
+	}
+}
+
+// Opcode returns the opcode of tx
+func Opcode(tx mcm.TX) uint16 {
+	return binary.LittleEndian.Uint16(tx.Opcode[:])
+}
+
+// Node returns the node owning the connection
+func (c *Conn) Node() *Node {
+	return c.node
+}
+
+// Recv reads one TX from the client
+func (c *Conn) Recv() (mcm.TX, error) {
+	buf := make([]byte, 8920)
+	if _, err := io.ReadFull(c.conn, buf); err != nil {
+		return mcm.TX{}, err
+	}
+	tx := mcm.NewTX(buf)
+	if crc(&tx) != binary.LittleEndian.Uint16(tx.Crc16[:]) {
+		return mcm.TX{}, errors.New("crc16 checksum failed")
+	}
+	return tx, nil
+}
+
+// Send sends a TX with opcode op to the client. fill, if not nil, sets the
+// payload; the protocol fields and the crc16 are set by Send.
+func (c *Conn) Send(op uint16, fill func(tx *mcm.TX)) error {
+	c.node.mu.Lock()
+	pversion, caps := c.node.pversion, c.node.caps
+	c.node.mu.Unlock()
+
+	tx := mcm.NewTX(nil)
+	tx.Version = [2]byte{pversion, caps}
+	tx.ID2 = c.id2
+	binary.LittleEndian.PutUint16(tx.Opcode[:], op)
+	binary.LittleEndian.PutUint64(tx.Cblock[:], c.node.Chain.Height())
+	if hash, ok := c.node.Chain.BlockHash(c.node.Chain.Height()); ok {
+		tx.Cblockhash = hash
+	}
+	if fill != nil {
+		fill(&tx)
+	}
+	binary.LittleEndian.PutUint16(tx.Crc16[:], crc(&tx))
+	_, err := c.conn.Write(tx.GetBytes())
+	return err
+}
+
+// RecvFile reads a file sent with OP_SEND_FILE packets, up to the first
+// packet shorter than mcm.SEND_FILE_LEN
+func (c *Conn) RecvFile() ([]byte, error) {
+	var file []byte
+	for {
+		tx, err := c.Recv()
+		if err != nil {
+			return nil, err
+		}
+		if Opcode(tx) != mcm.OP_SEND_FILE {
+			return nil, fmt.Errorf("unexpected opcode %d in file", Opcode(tx))
+		}
+		n := int(binary.LittleEndian.Uint16(tx.Len[:]))
+		if n > mcm.SEND_FILE_LEN {
+			return nil, fmt.Errorf("file packet too long: %d bytes", n)
+		}
+		file = append(file, tx.GetBytes()[124:124+n]...)
+		if n < mcm.SEND_FILE_LEN {
+			return file, nil
+		}
+	}
+}
+
+// SendFile streams data with OP_SEND_FILE packets, the end of the file
+// being marked by a packet shorter than mcm.SEND_FILE_LEN, empty if needed
+func (c *Conn) SendFile(data []byte) error {
+	for {
+		chunk := data
+		if len(chunk) > mcm.SEND_FILE_LEN {
+			chunk = chunk[:mcm.SEND_FILE_LEN]
+		}
+		data = data[len(chunk):]
+		err := c.Send(mcm.OP_SEND_FILE, func(tx *mcm.TX) {
+			binary.LittleEndian.PutUint16(tx.Len[:], uint16(len(chunk)))
+			setPayload(tx, chunk)
+		})
+		if err != nil || len(chunk) < mcm.SEND_FILE_LEN {
+			return err
+		}
+	}
+}
+
+// setPayload copies data in the TX starting from Src_addr
+func setPayload(tx *mcm.TX, data []byte) {
+	bytes := tx.GetBytes()
+	copy(bytes[124:8916], data)
+	tx.Deserialize(bytes)
+}
+
+// crc computes the crc16 of tx up to the signature
+func crc(tx *mcm.TX) uint16 {
+	table := crc16.MakeTable(crc16.CRC16_XMODEM)
+	return crc16.Checksum(tx.GetBytes()[:8916], table)
+}
@@ -0,0 +1,169 @@
+package mcmtest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+
+	mcm "github.com/NickP005/go_mcminterface"
+)
+
+// longChain returns a chain of 1006 blocks, neo-genesis and pseudo-blocks,
+// whose neo-genesis ledgers hold balance
+func longChain(balance uint64) *Chain {
+	chain := NewChain()
+	chain.SetBalance(testAddress("funded"), balance)
+	for chain.Height() < 768 {
+		chain.AddNeoGenesis()
+	}
+	for chain.Height() < 1005 {
+		chain.AddPseudoBlock()
+	}
+	return chain
+}
+
+func trailers(t *testing.T, chain *Chain) []mcm.BTRAILER {
+	t.Helper()
+	trailers, err := mcm.ReadTrailers(bytes.NewReader(chain.Trailers(0, chain.Height()+1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return trailers
+}
+
+// rehash sets the block hash of a pseudo-block trailer
+func rehash(tr *mcm.BTRAILER) {
+	bytes := append(pseudoHeader(), tr.GetBytes()...)
+	tr.Bhash = sha256.Sum256(bytes[:len(bytes)-mcm.HASHLEN])
+}
+
+func TestValidateTrailerChain(t *testing.T) {
+	chain := longChain(1000)
+	if err := mcm.ValidateTrailerChain(trailers(t, chain)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		index  int
+		tamper func(tr *mcm.BTRAILER)
+		reason string
+	}{
+		{"pseudo-block hash", 3, func(tr *mcm.BTRAILER) { tr.Mfee[0] ^= 1 }, "block hash of pseudo-block"},
+		{"empty hash", 256, func(tr *mcm.BTRAILER) { tr.Bhash = [mcm.HASHLEN]byte{} }, "empty block hash"},
+		{"block number", 5, func(tr *mcm.BTRAILER) { tr.Bnum[1] = 1; rehash(tr) }, "block number does not follow 4"},
+		{"previous hash after a chunk", 1000, func(tr *mcm.BTRAILER) { tr.Phash[0] ^= 1; rehash(tr) }, "previous hash does not match the hash of block 999"},
+	}
+	for _, test := range tests {
+		list := trailers(t, chain)
+		test.tamper(&list[test.index])
+		err := mcm.ValidateTrailerChain(list)
+		var chain_err *mcm.ErrTrailerChain
+		if !errors.As(err, &chain_err) {
+			t.Errorf("%s: err = %v, want *ErrTrailerChain", test.name, err)
+			continue
+		}
+		if chain_err.Index != test.index || !strings.Contains(chain_err.Reason, test.reason) {
+			t.Errorf("%s: %v, want trailer %d: %s", test.name, err, test.index, test.reason)
+		}
+	}
+}
+
+func TestQueryBTrailersValidated(t *testing.T) {
+	chain := longChain(1000)
+	client := NewTestNetwork(t, chain).Client(1)
+	client.ValidateTrailers = true
+
+	list, err := client.QueryBTrailers(0, 1006)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1006 {
+		t.Errorf("%d trailers, want 1006", len(list))
+	}
+
+	// past the tip
+	if _, err := client.QueryBTrailers(1000, 10); err == nil {
+		t.Error("QueryBTrailers past the tip returned no error")
+	}
+	client.ValidateTrailers = false
+	if list, err := client.QueryBTrailers(1000, 10); err != nil || len(list) != 6 {
+		t.Errorf("unvalidated past the tip: %d trailers, err = %v, want 6", len(list), err)
+	}
+	client.ValidateTrailers = true
+
+	// the second chunk comes from another chain of the same height
+	other := longChain(2000)
+	network := NewTestNetwork(t, chain)
+	network.Node("10.0.0.1").Handle(mcm.OP_TF, func(c *Conn, req mcm.TX) error {
+		if req.Blocknum[1] != 0 || req.Blocknum[0] != 0 {
+			return c.SendFile(other.Trailers(1000, 6))
+		}
+		return handleTF(c, req)
+	})
+	client = network.Client(1)
+	client.ValidateTrailers = true
+	_, err = client.QueryBTrailers(0, 1006)
+	var chain_err *mcm.ErrTrailerChain
+	if !errors.As(err, &chain_err) || chain_err.Index != 1000 {
+		t.Errorf("broken chunk link: err = %v, want trailer 1000", err)
+	}
+}
+
+func TestVerifyEmptyNormalBlock(t *testing.T) {
+	block := mcm.Block{Header: mcm.BHEADER{Hdrlen: 2220}}
+	block.Trailer.Bnum[0] = 1
+	bytes := block.GetBytes()
+	block.Trailer.Bhash = sha256.Sum256(bytes[:len(bytes)-mcm.HASHLEN])
+	if err := block.Verify(); err == nil || !strings.Contains(err.Error(), "without transactions") {
+		t.Errorf("err = %v, want a normal block without transactions", err)
+	}
+}
+
+func TestValidateTransactions(t *testing.T) {
+	dst := testAddress("dst")
+	a := signedTransaction(t, "source a", 10000, dst, 1000)
+	b := signedTransaction(t, "source b", 10000, dst, 1000)
+	if bytes.Compare(a.Tx_id[:], b.Tx_id[:]) > 0 {
+		a, b = b, a
+	}
+	block := func(body ...mcm.TXQENTRY) *mcm.Block {
+		block := &mcm.Block{Header: mcm.BHEADER{Hdrlen: 2220}, Body: body}
+		block.Trailer.Bnum[0] = 1
+		binary.LittleEndian.PutUint64(block.Trailer.Mfee[:], 500)
+		return block
+	}
+	if err := block(a, b).ValidateTransactions(); err != nil {
+		t.Fatal(err)
+	}
+
+	bad_sig := b
+	bad_sig.Tx_sig[100] ^= 1
+	overflow := b
+	binary.LittleEndian.PutUint64(overflow.Change_total[:], ^uint64(0))
+	high_fee := block(a, b)
+	binary.LittleEndian.PutUint64(high_fee.Trailer.Mfee[:], 1000)
+
+	tests := []struct {
+		name   string
+		block  *mcm.Block
+		index  int
+		reason string
+	}{
+		{"bad signature", block(a, bad_sig), 1, "invalid signature"},
+		{"overflow", block(a, overflow), 1, "amounts overflow"},
+		{"fee below Mfee", high_fee, 0, "fee 500 below the minimum 1000"},
+		{"duplicate source", block(a, a), 1, "already spent by transaction 0"},
+		{"descending Tx_id", block(b, a), 1, "ascending order"},
+	}
+	for _, test := range tests {
+		err := test.block.ValidateTransactions()
+		var tx_err *mcm.ErrBadTransaction
+		if !errors.As(err, &tx_err) || tx_err.Index != test.index || !strings.Contains(tx_err.Reason, test.reason) {
+			t.Errorf("%s: err = %v, want transaction %d: %s", test.name, err, test.index, test.reason)
+		}
+	}
+}
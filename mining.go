@@ -0,0 +1,118 @@
+package go_mcminterface
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Wait between two checks of whether a node adopted a mined block
+const MINED_BLOCK_POLL = 500 * time.Millisecond
+
+// BlockSubmission is what a node did with a mined block
+type BlockSubmission struct {
+	IP       string
+	Sent     bool  // the block was sent to the node
+	Accepted bool  // the node holds the block at its height
+	Err      error // why the block was not sent or not adopted, nil if accepted
+}
+
+// Send a solved block with OP_MBLOCK, the block following as a file. The
+// node does not answer: if the block is valid it is added to the chain of
+// the node, which announces it to its peers with OP_FOUND.
+func (m *SocketData) SubmitMinedBlock(block Block) error {
+	return m.SubmitMinedBlockContext(context.Background(), block)
+}
+
+// Send a solved block with OP_MBLOCK, giving up when ctx is done
+func (m *SocketData) SubmitMinedBlockContext(ctx context.Context, block Block) error {
+	m.send_tx = NewTX(nil)
+	m.send_tx.ID1 = m.recv_tx.ID1
+	m.send_tx.ID2 = m.recv_tx.ID2
+	copy(m.send_tx.Cblock[:], block.Trailer.Bnum[:])
+	copy(m.send_tx.Cblockhash[:], block.Trailer.Bhash[:])
+
+	// Send OP_MBLOCK then the block as a file
+	err := m.SendOPContext(ctx, OP_MBLOCK)
+	if err != nil {
+		return err
+	}
+	return m.sendFile(ctx, block.GetBytes())
+}
+
+// SubmitMinedBlock sends a solved block to QuerySize nodes, then checks on
+// each of them whether the block was adopted, until QueryTimeout. It fails
+// only if no node adopted the block.
+func (c *Client) SubmitMinedBlock(block Block) ([]BlockSubmission, error) {
+	return c.SubmitMinedBlockContext(context.Background(), block)
+}
+
+// SubmitMinedBlockContext is SubmitMinedBlock giving up when ctx is done
+func (c *Client) SubmitMinedBlockContext(ctx context.Context, block Block) ([]BlockSubmission, error) {
+	if c.Settings.QueryTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(c.Settings.QueryTimeout)*time.Second)
+		defer cancel()
+	}
+
+	// every node gets the block, so that it spreads as fast as possible
+	nodes := c.PickNodes(c.Settings.QuerySize)
+	report := make([]BlockSubmission, len(nodes))
+	var wg sync.WaitGroup
+	for i, node := range nodes {
+		wg.Add(1)
+		go func(i int, node RemoteNode) {
+			defer wg.Done()
+			report[i].IP = node.IP
+			_, err := queryNode(ctx, c, node, func(ctx context.Context, sd *SocketData) (bool, error) {
+				return true, sd.SubmitMinedBlockContext(ctx, block)
+			})
+			if err == nil {
+				report[i].Sent = true
+				err = c.waitForBlock(ctx, node, block.Trailer)
+			}
+			if err != nil {
+				c.logger().Warn("mined block not adopted", "node", node.IP, "error", err)
+			}
+			report[i].Accepted = err == nil
+			report[i].Err = err
+		}(i, node)
+	}
+	wg.Wait()
+
+	for _, submission := range report {
+		if submission.Accepted {
+			return report, nil
+		}
+	}
+	return report, fmt.Errorf("no node adopted the block")
+}
+
+// waitForBlock polls node until it holds the block of trailer at its height,
+// or holds another block there
+func (c *Client) waitForBlock(ctx context.Context, node RemoteNode, trailer BTRAILER) error {
+	bnum := binary.LittleEndian.Uint64(trailer.Bnum[:])
+	for {
+		hash, err := queryNode(ctx, c, node, func(ctx context.Context, sd *SocketData) ([HASHLEN]byte, error) {
+			// the handshake tells the latest block of the node
+			if sd.block_num < bnum {
+				return [HASHLEN]byte{}, nil
+			}
+			return sd.GetBlockHashContext(ctx, bnum)
+		})
+		if err == nil && hash == trailer.Bhash {
+			return nil
+		}
+		if err == nil && hash != [HASHLEN]byte{} {
+			return fmt.Errorf("node holds another block %d", bnum)
+		}
+		if !sleepContext(ctx, MINED_BLOCK_POLL) {
+			if err != nil {
+				return fmt.Errorf("node did not adopt block %d: %w", bnum, err)
+			}
+			return fmt.Errorf("node did not adopt block %d", bnum)
+		}
+	}
+}
@@ -1,27 +1,32 @@
 package go_mcminterface
 
 import (
+	"context"
 	"encoding/binary"
 	"fmt"
+	"io"
 )
 
 // Get IP list
 func (m *SocketData) GetIPList() ([]string, error) {
+	return m.GetIPListContext(context.Background())
+}
+
+// Get IP list, giving up when ctx is done
+func (m *SocketData) GetIPListContext(ctx context.Context) ([]string, error) {
 	// Send OP_GET_IPL
-	err := m.SendOP(OP_GET_IPL)
+	err := m.SendOPContext(ctx, OP_GET_IPL)
 	if err != nil {
 		return nil, err
 	}
 	// Receive TX struct
-	err = m.recvTX()
+	err = m.recvTX(ctx)
 	if err != nil {
 		return nil, err
 	}
 	// Check if opcode is OP_SEND_IPL
-	if m.recv_tx.Opcode[0] != byte(OP_SEND_IPL) {
-		fmt.Println("Opcode:", m.recv_tx.Opcode)
-
-		return nil, (fmt.Errorf("opcode is not OP_SEND_IPL"))
+	if err := m.expectOP(OP_SEND_IPL); err != nil {
+		return nil, err
 	}
 	// Read IP list from src_addr
 	var ips []string
@@ -34,6 +39,11 @@ func (m *SocketData) GetIPList() ([]string, error) {
 
 // Resolve tag
 func (m *SocketData) ResolveTag(tag []byte) (WotsAddress, error) {
+	return m.ResolveTagContext(context.Background(), tag)
+}
+
+// Resolve tag, giving up when ctx is done
+func (m *SocketData) ResolveTagContext(ctx context.Context, tag []byte) (WotsAddress, error) {
 	m.send_tx = NewTX(nil)
 	m.send_tx.ID1 = m.recv_tx.ID1
 	m.send_tx.ID2 = m.recv_tx.ID2
@@ -44,24 +54,24 @@ func (m *SocketData) ResolveTag(tag []byte) (WotsAddress, error) {
 	// Set the destination address
 	m.send_tx.Dst_addr = wots_addr.Address
 	// Send OP_RESOLVE
-	err := m.SendOP(OP_RESOLVE)
+	err := m.SendOPContext(ctx, OP_RESOLVE)
 	if err != nil {
 		return WotsAddress{}, err
 	}
 
-	err = m.recvTX()
+	err = m.recvTX(ctx)
 	if err != nil {
 		return WotsAddress{}, err
 	}
 
 	// Check if opcode is OP_SEND_RESOLVE
-	if m.recv_tx.Opcode[0] != byte(OP_RESOLVE) {
-		return WotsAddress{}, (fmt.Errorf("opcode is not OP_RESOLVE"))
+	if err := m.expectOP(OP_RESOLVE); err != nil {
+		return WotsAddress{}, err
 	}
 
 	// Check if send total is one, else tag not found
 	if m.recv_tx.Send_total[0] != 1 {
-		return WotsAddress{}, (fmt.Errorf("tag not found"))
+		return WotsAddress{}, ErrTagNotFound
 	}
 
 	// Copy the address
@@ -75,6 +85,11 @@ func (m *SocketData) ResolveTag(tag []byte) (WotsAddress, error) {
 
 // Get balance of a WotsAddress
 func (m *SocketData) GetBalance(wots_addr WotsAddress) (uint64, error) {
+	return m.GetBalanceContext(context.Background(), wots_addr)
+}
+
+// Get balance of a WotsAddress, giving up when ctx is done
+func (m *SocketData) GetBalanceContext(ctx context.Context, wots_addr WotsAddress) (uint64, error) {
 	m.send_tx = NewTX(nil)
 	m.send_tx.ID1 = m.recv_tx.ID1
 	m.send_tx.ID2 = m.recv_tx.ID2
@@ -83,24 +98,24 @@ func (m *SocketData) GetBalance(wots_addr WotsAddress) (uint64, error) {
 	m.send_tx.Src_addr = wots_addr.Address
 
 	// Send OP_GET_BALANCE
-	err := m.SendOP(OP_BALANCE)
+	err := m.SendOPContext(ctx, OP_BALANCE)
 	if err != nil {
 		return 0, err
 	}
 
-	err = m.recvTX()
+	err = m.recvTX(ctx)
 	if err != nil {
 		return 0, err
 	}
 
 	// Check if opcode is OP_SEND_BALANCE
-	if m.recv_tx.Opcode[0] != byte(OP_SEND_BAL) {
-		return 0, (fmt.Errorf("opcode is not OP_SEND_BAL"))
+	if err := m.expectOP(OP_SEND_BAL); err != nil {
+		return 0, err
 	}
 
 	// Change total should be 1
 	if m.recv_tx.Change_total[0] != 1 {
-		return 0, (fmt.Errorf("address not found"))
+		return 0, ErrAddressNotFound
 	}
 
 	// Get the balance
@@ -109,6 +124,11 @@ func (m *SocketData) GetBalance(wots_addr WotsAddress) (uint64, error) {
 
 // Get block from block number
 func (m *SocketData) GetBlockBytes(block_num uint64) ([]byte, error) {
+	return m.GetBlockBytesContext(context.Background(), block_num)
+}
+
+// Get block from block number, the download is aborted when ctx is done
+func (m *SocketData) GetBlockBytesContext(ctx context.Context, block_num uint64) ([]byte, error) {
 	m.send_tx = NewTX(nil)
 	m.send_tx.ID1 = m.recv_tx.ID1
 	m.send_tx.ID2 = m.recv_tx.ID2
@@ -117,22 +137,26 @@ func (m *SocketData) GetBlockBytes(block_num uint64) ([]byte, error) {
 	binary.LittleEndian.PutUint64(m.send_tx.Blocknum[:], block_num)
 
 	// Send OP_GET_BLOCK
-	err := m.SendOP(OP_GET_BLOCK)
+	err := m.SendOPContext(ctx, OP_GET_BLOCK)
 	if err != nil {
 		return nil, err
 	}
 
-	file, err := m.recvFile()
+	file, err := m.recvFile(ctx)
 	if err != nil {
 		return nil, err
 	}
-	//print file length
-	fmt.Println("File length:", len(file))
+	m.log().Debug("block downloaded", "block", block_num, "bytes", len(file))
 	return file, nil
 }
 
 // Get block 32 bytes hash
 func (m *SocketData) GetBlockHash(block_num uint64) ([HASHLEN]byte, error) {
+	return m.GetBlockHashContext(context.Background(), block_num)
+}
+
+// Get block 32 bytes hash, giving up when ctx is done
+func (m *SocketData) GetBlockHashContext(ctx context.Context, block_num uint64) ([HASHLEN]byte, error) {
 	m.send_tx = NewTX(nil)
 	m.send_tx.ID1 = m.recv_tx.ID1
 	m.send_tx.ID2 = m.recv_tx.ID2
@@ -145,19 +169,19 @@ func (m *SocketData) GetBlockHash(block_num uint64) ([HASHLEN]byte, error) {
 	}
 
 	// Send OP_HASH
-	err := m.SendOP(OP_HASH)
+	err := m.SendOPContext(ctx, OP_HASH)
 	if err != nil {
 		return [HASHLEN]byte{}, err
 	}
 
-	err = m.recvTX()
+	err = m.recvTX(ctx)
 	if err != nil {
 		return [HASHLEN]byte{}, err
 	}
 
 	// Check if opcode is OP_HASH
-	if m.recv_tx.Opcode[0] != byte(OP_HASH) {
-		return [HASHLEN]byte{}, (fmt.Errorf("opcode is not OP_HASH"))
+	if err := m.expectOP(OP_HASH); err != nil {
+		return [HASHLEN]byte{}, err
 	}
 
 	// Get the block hash
@@ -166,7 +190,13 @@ func (m *SocketData) GetBlockHash(block_num uint64) ([HASHLEN]byte, error) {
 	return block_hash, nil
 }
 
+// Get `count` trailers starting from block_num
 func (m *SocketData) GetTrailersBytes(block_num uint32, count uint32) ([]byte, error) {
+	return m.GetTrailersBytesContext(context.Background(), block_num, count)
+}
+
+// Get `count` trailers starting from block_num, giving up when ctx is done
+func (m *SocketData) GetTrailersBytesContext(ctx context.Context, block_num uint32, count uint32) ([]byte, error) {
 	m.send_tx = NewTX(nil)
 	m.send_tx.ID1 = m.recv_tx.ID1
 	m.send_tx.ID2 = m.recv_tx.ID2
@@ -181,13 +211,13 @@ func (m *SocketData) GetTrailersBytes(block_num uint32, count uint32) ([]byte, e
 	binary.LittleEndian.PutUint32(m.send_tx.Blocknum[4:], count)
 
 	// Send OP_TF
-	err := m.SendOP(OP_TF)
+	err := m.SendOPContext(ctx, OP_TF)
 	if err != nil {
 		return nil, err
 	}
 
 	// receive file
-	file, err := m.recvFile()
+	file, err := m.recvFile(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -206,8 +236,71 @@ func (m *SocketData) GetTrailersBytes(block_num uint32, count uint32) ([]byte, e
 	return file, nil
 }
 
+// Get the candidate block the node is about to mine
+func (m *SocketData) GetCandidateBlock() (Block, error) {
+	return m.GetCandidateBlockContext(context.Background())
+}
+
+// GetCandidateBlockContext is GetCandidateBlock, the download is aborted when ctx is done
+func (m *SocketData) GetCandidateBlockContext(ctx context.Context) (Block, error) {
+	m.send_tx = NewTX(nil)
+	m.send_tx.ID1 = m.recv_tx.ID1
+	m.send_tx.ID2 = m.recv_tx.ID2
+
+	// Send OP_GET_CBLOCK
+	err := m.SendOPContext(ctx, OP_GET_CBLOCK)
+	if err != nil {
+		return Block{}, err
+	}
+
+	file, err := m.recvFile(ctx)
+	if err != nil {
+		return Block{}, err
+	}
+	m.log().Debug("candidate block downloaded", "bytes", len(file))
+
+	block, err := ParseBlock(file)
+	if err != nil {
+		return Block{}, fmt.Errorf("candidate block: %w", err)
+	}
+	return block, nil
+}
+
+// Get the whole trailer file of the node, streaming it to w. The first
+// `offset` bytes are received but not written, to complete a partial file:
+// the node always sends the file from the start. progress, if not nil, is
+// called with the bytes written so far.
+func (m *SocketData) GetTrailerFile(w io.Writer, offset int64, progress func(written int64)) (int64, error) {
+	return m.GetTrailerFileContext(context.Background(), w, offset, progress)
+}
+
+// GetTrailerFileContext is GetTrailerFile, the download is aborted when ctx is done
+func (m *SocketData) GetTrailerFileContext(ctx context.Context, w io.Writer, offset int64, progress func(written int64)) (int64, error) {
+	m.send_tx = NewTX(nil)
+	m.send_tx.ID1 = m.recv_tx.ID1
+	m.send_tx.ID2 = m.recv_tx.ID2
+
+	// Send OP_GET_TFILE
+	err := m.SendOPContext(ctx, OP_GET_TFILE)
+	if err != nil {
+		return 0, err
+	}
+
+	written, err := m.recvFileTo(ctx, w, offset, progress)
+	m.log().Debug("trailer file downloaded", "offset", offset, "bytes", written, "error", err)
+	return written, err
+}
+
 // Submit a transaction
 func (m *SocketData) SubmitTransaction(tx Transaction) error {
+	return m.SubmitTransactionContext(context.Background(), tx)
+}
+
+// Submit a transaction, giving up when ctx is done
+func (m *SocketData) SubmitTransactionContext(ctx context.Context, tx Transaction) error {
+	if m.pversion >= PVERSION3 {
+		return fmt.Errorf("%w: node speaks protocol %d, see SubmitTransactionV3", ErrProtocolVersion, m.pversion)
+	}
 	m.send_tx = NewTX(nil)
 	m.send_tx.ID1 = m.recv_tx.ID1
 	m.send_tx.ID2 = m.recv_tx.ID2
@@ -222,10 +315,37 @@ func (m *SocketData) SubmitTransaction(tx Transaction) error {
 	m.send_tx.Tx_sig = tx.Tx_sig
 
 	// Send OP_TX
-	err := m.SendOP(OP_TX)
+	err := m.SendOPContext(ctx, OP_TX)
 	if err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// Submit a v3 transaction to a node speaking PVERSION3. The OP_TX frame
+// carries the transaction bytes in its buffer, Len telling their size.
+func (m *SocketData) SubmitTransactionV3(tx TransactionV3) error {
+	return m.SubmitTransactionV3Context(context.Background(), tx)
+}
+
+// Submit a v3 transaction, giving up when ctx is done
+func (m *SocketData) SubmitTransactionV3Context(ctx context.Context, tx TransactionV3) error {
+	if m.pversion < PVERSION3 {
+		return fmt.Errorf("%w: node speaks protocol %d, see SubmitTransaction", ErrProtocolVersion, m.pversion)
+	}
+	tx_bytes := tx.Bytes()
+	if len(tx_bytes) > TXV3_FRAME_LEN {
+		return fmt.Errorf("v3 transaction of %d bytes does not fit a TX frame", len(tx_bytes))
+	}
+	m.send_tx = NewTX(nil)
+	m.send_tx.Version[0] = PVERSION3
+	m.send_tx.ID1 = m.recv_tx.ID1
+	m.send_tx.ID2 = m.recv_tx.ID2
+	binary.LittleEndian.PutUint16(m.send_tx.Len[:], uint16(len(tx_bytes)))
+	bytes := m.send_tx.GetBytes()
+	copy(bytes[124:124+TXV3_FRAME_LEN], tx_bytes)
+	m.send_tx.Deserialize(bytes)
+
+	return m.SendOPContext(ctx, OP_TX)
+}
@@ -1,11 +1,16 @@
 package go_mcminterface
 
 import (
+	"bytes"
+	"context"
 	"crypto/rand"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net"
+	"strconv"
 	"time"
 
 	"github.com/sigurn/crc16"
@@ -21,7 +26,6 @@ const (
 // Define constants
 const (
 	PVERSION  = 4      /* protocol version number (short) */
-	CWALLET   = 2      /* indicate that we are a wallet */
 	TXNETWORK = 0x3905 /* network number for transactions */
 	TXTRAILER = 0xcdab /* trailer for transactions comms */
 
@@ -54,8 +58,42 @@ const (
 	TXSIGLEN     = 2144
 	HASHLEN      = 32
 	BTRAILER_LEN = 160
+
+	SEND_FILE_LEN = 8792 /* max payload of an OP_SEND_FILE packet */
 )
 
+// opNames maps the opcodes to their names
+var opNames = map[uint16]string{
+	OP_NULL:       "OP_NULL",
+	OP_HELLO:      "OP_HELLO",
+	OP_HELLO_ACK:  "OP_HELLO_ACK",
+	OP_TX:         "OP_TX",
+	OP_FOUND:      "OP_FOUND",
+	OP_GET_BLOCK:  "OP_GET_BLOCK",
+	OP_GET_IPL:    "OP_GET_IPL",
+	OP_SEND_FILE:  "OP_SEND_FILE",
+	OP_SEND_IPL:   "OP_SEND_IPL",
+	OP_BUSY:       "OP_BUSY",
+	OP_NACK:       "OP_NACK",
+	OP_GET_TFILE:  "OP_GET_TFILE",
+	OP_BALANCE:    "OP_BALANCE",
+	OP_SEND_BAL:   "OP_SEND_BAL",
+	OP_RESOLVE:    "OP_RESOLVE",
+	OP_GET_CBLOCK: "OP_GET_CBLOCK",
+	OP_MBLOCK:     "OP_MBLOCK",
+	OP_HASH:       "OP_HASH",
+	OP_TF:         "OP_TF",
+	OP_IDENTIFY:   "OP_IDENTIFY",
+}
+
+// opName returns the name of op, or its number if unknown
+func opName(op uint16) string {
+	if name, ok := opNames[op]; ok {
+		return name
+	}
+	return fmt.Sprintf("opcode %d", op)
+}
+
 type TX struct {
 	Version      [2]byte
 	Network      [2]byte
@@ -177,67 +215,140 @@ func (m *TX) GetVersion() int {
 }
 
 type SocketData struct {
-	IP        string
-	Conn      net.Conn
-	send_tx   TX
-	recv_tx   TX
-	block_num uint64
+	IP            string
+	Conn          net.Conn
+	send_tx       TX
+	recv_tx       TX
+	block_num     uint64
+	pversion      int           // protocol version of the node, from its hello
+	dialer        Dialer        // net.Dialer if nil
+	logger        *slog.Logger  // silent if nil
+	read_timeout  time.Duration // SOCK_READ_TIMEOUT if zero
+	write_timeout time.Duration // SOCK_WRITE_TIMEOUT if zero
 }
 
 // Send OP to IP
 func (m *SocketData) SendOP(op uint16) error {
+	return m.SendOPContext(context.Background(), op)
+}
+
+// Send OP to IP, aborting the write when ctx is done
+func (m *SocketData) SendOPContext(ctx context.Context, op uint16) error {
 	// Set the opcode
 	m.send_tx.Opcode = [2]byte{byte(op & 0xff), byte(op >> 8)}
 	m.send_tx.computeCRC16()
-	//fmt.Println("Sending OP:", op)
+	m.log().Debug("sending", "op", opName(op))
 	// Send the TX struct
-	return m.sendTX()
+	return m.sendTX(ctx)
 }
 
 // Connect to IP : 2095
 func (m *SocketData) Connect() {
+	m.ConnectContext(context.Background())
+}
+
+// Connect to IP : 2095, the dial is aborted when ctx is done
+func (m *SocketData) ConnectContext(ctx context.Context) error {
 	// Connect to the IP
 	// print
-	address := fmt.Sprintf("%s:%d", m.IP, DEFAULT_PORT)
-	fmt.Println("Connecting to:", address)
-	conn, err := net.Dial("tcp", address)
+	address := net.JoinHostPort(m.IP, strconv.Itoa(DEFAULT_PORT))
+	m.log().Debug("connecting", "address", address)
+	start := time.Now()
+	var dialer Dialer = &net.Dialer{}
+	if m.dialer != nil {
+		dialer = m.dialer
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
 	if err != nil {
-		fmt.Println("Error connecting:", err)
-		return
+		m.log().Debug("connection failed", "address", address, "error", err)
+		return err
 	}
-	fmt.Println("Connected to:", address)
+	m.log().Debug("connected", "address", address, "latency", time.Since(start))
 	m.Conn = conn
-	m.Conn.SetWriteDeadline(time.Now().Add(SOCK_WRITE_TIMEOUT * time.Second))
-	m.Conn.SetReadDeadline(time.Now().Add(SOCK_READ_TIMEOUT * time.Second))
+	return nil
+}
+
+// ioDeadline returns the deadline of a single socket operation: the given
+// timeout, or the deadline of ctx if it comes first
+func ioDeadline(ctx context.Context, timeout time.Duration) time.Time {
+	deadline := time.Now().Add(timeout)
+	if ctx_deadline, ok := ctx.Deadline(); ok && ctx_deadline.Before(deadline) {
+		return ctx_deadline
+	}
+	return deadline
+}
+
+// abortOnDone makes any pending read or write on the connection fail as soon
+// as ctx is done. The returned function stops watching ctx.
+func (m *SocketData) abortOnDone(ctx context.Context) func() bool {
+	conn := m.Conn
+	return context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Unix(1, 0))
+	})
+}
+
+// ctxError replaces err with the context error when the operation failed
+// because ctx was cancelled or expired
+func ctxError(ctx context.Context, err error) error {
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
 }
 
 // Send TX struct to IP
-func (m *SocketData) sendTX() error {
+func (m *SocketData) sendTX(ctx context.Context) error {
 	// Check if connection is active
 	if m.Conn == nil {
 		return fmt.Errorf("connection is nil")
 	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	stop := m.abortOnDone(ctx)
+	defer stop()
+	timeout := m.write_timeout
+	if timeout == 0 {
+		timeout = SOCK_WRITE_TIMEOUT * time.Second
+	}
+	m.Conn.SetWriteDeadline(ioDeadline(ctx, timeout))
+
 	bytes := m.send_tx.GetBytes()
 	_, err := m.Conn.Write(bytes)
 	if err != nil {
-		fmt.Println("Error writing:", err)
-		return err
+		m.log().Debug("write failed", "op", opName(binary.LittleEndian.Uint16(m.send_tx.Opcode[:])), "error", err)
+		return ctxError(ctx, err)
 	}
 	return nil
 }
 
 // Receive TX struct from IP
-func (m *SocketData) recvTX() error {
+func (m *SocketData) recvTX(ctx context.Context) error {
+	// Check if connection is active
+	if m.Conn == nil {
+		return fmt.Errorf("connection is nil")
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	stop := m.abortOnDone(ctx)
+	defer stop()
+	timeout := m.read_timeout
+	if timeout == 0 {
+		timeout = SOCK_READ_TIMEOUT * time.Second
+	}
+	m.Conn.SetReadDeadline(ioDeadline(ctx, timeout))
+
 	buf := make([]byte, 8920)
 	// read full
 	n, err := io.ReadFull(m.Conn, buf)
 	if err != nil {
 		if err == io.EOF && n != 0 {
-			fmt.Println("Connection closed before reading all bytes")
+			m.log().Debug("connection closed before reading all bytes", "read", n)
 		} else if n != 0 {
-			fmt.Println("Error reading:", err)
+			m.log().Debug("read failed", "read", n, "error", err)
 		}
-		return err
+		return ctxError(ctx, err)
 	}
 	// If received less than 8920 bytes, return
 	if n < 8920 {
@@ -252,21 +363,15 @@ func (m *SocketData) recvTX() error {
 	rcrc16 := crc16.Checksum(m.recv_tx.GetBytes()[:8916], table)
 	// Check if rcrc16 is equal to crc16
 	if rcrc16 != binary.LittleEndian.Uint16(m.recv_tx.Crc16[:]) {
-		fmt.Printf("crc16: %x\n", m.recv_tx.Crc16)
-		fmt.Printf("rcrc16: %x\n", rcrc16)
-		// print ID1
-		fmt.Println("ID1:", m.recv_tx.ID1)
-		// print ID2
-		fmt.Println("ID2:", m.recv_tx.ID2)
-
-		// print the received tx
-		//fmt.Println("recv_tx:", m.recv_tx.GetBytes())
-		return fmt.Errorf("crc16 checksum failed")
+		m.log().Debug("crc16 checksum failed",
+			"crc16", binary.LittleEndian.Uint16(m.recv_tx.Crc16[:]), "computed", rcrc16,
+			"id1", m.recv_tx.ID1, "id2", m.recv_tx.ID2)
+		return ErrChecksum
 	}
 
 	// Check the trailer
 	if binary.BigEndian.Uint16(m.recv_tx.Trailer[:]) != TXTRAILER {
-		return fmt.Errorf("trailer failed")
+		return ErrBadTrailer
 	}
 
 	// Get the block number
@@ -275,30 +380,104 @@ func (m *SocketData) recvTX() error {
 }
 
 // Receive file from IP
-func (m *SocketData) recvFile() ([]byte, error) {
-	var file []byte
+func (m *SocketData) recvFile(ctx context.Context) ([]byte, error) {
+	var file bytes.Buffer
+	_, err := m.recvFileTo(ctx, &file, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	return file.Bytes(), nil
+}
+
+// Receive file from IP and write it to w, dropping the first `skip` bytes.
+// The file ends with a packet shorter than SEND_FILE_LEN, or when the node
+// closes the connection. progress, if not nil, is called with the bytes
+// written so far.
+func (m *SocketData) recvFileTo(ctx context.Context, w io.Writer, skip int64, progress func(written int64)) (int64, error) {
+	var written int64
 
-	// Until the connection is closed, keep receiving TX structs
+	// Until a short packet or the connection is closed, keep receiving TX structs
 	for {
-		err := m.recvTX()
+		err := m.recvTX(ctx)
 		if err != nil {
-			if err == io.EOF {
+			if errors.Is(err, io.EOF) {
 				break
 			}
-			return nil, err
+			return written, err
 		}
 		// Check if opcode is OP_SEND_FILE
-		if m.recv_tx.Opcode[0] != byte(OP_SEND_FILE) {
-			return nil, fmt.Errorf("opcode is not OP_SEND_FILE")
+		if err := m.expectOP(OP_SEND_FILE); err != nil {
+			return written, err
 		}
 
-		// Bytes received in len
-		len := binary.LittleEndian.Uint16(m.recv_tx.Len[:])
+		// Bytes received in len, set by the node
+		len := int64(binary.LittleEndian.Uint16(m.recv_tx.Len[:]))
+		if len > SEND_FILE_LEN {
+			return written, fmt.Errorf("%w: %d bytes", ErrBadPacket, len)
+		}
 
 		// Get the bytes
-		file = append(file, m.recv_tx.GetBytes()[124:124+len]...)
+		chunk := m.recv_tx.GetBytes()[124 : 124+len]
+		if skip >= len {
+			skip -= len
+		} else {
+			n, err := w.Write(chunk[skip:])
+			skip = 0
+			written += int64(n)
+			if err != nil {
+				return written, err
+			}
+			if progress != nil {
+				progress(written)
+			}
+		}
+		if len < SEND_FILE_LEN {
+			break
+		}
 	}
-	return file, nil
+	return written, nil
+}
+
+// Send data to IP as a file, in OP_SEND_FILE packets. The end of the file is
+// marked by a packet shorter than SEND_FILE_LEN, empty if needed.
+func (m *SocketData) sendFile(ctx context.Context, data []byte) error {
+	for {
+		chunk := data
+		if len(chunk) > SEND_FILE_LEN {
+			chunk = chunk[:SEND_FILE_LEN]
+		}
+		data = data[len(chunk):]
+
+		m.send_tx = NewTX(nil)
+		m.send_tx.ID1 = m.recv_tx.ID1
+		m.send_tx.ID2 = m.recv_tx.ID2
+		binary.LittleEndian.PutUint16(m.send_tx.Len[:], uint16(len(chunk)))
+		bytes := m.send_tx.GetBytes()
+		copy(bytes[124:124+SEND_FILE_LEN], chunk)
+		m.send_tx.Deserialize(bytes)
+
+		if err := m.SendOPContext(ctx, OP_SEND_FILE); err != nil {
+			return err
+		}
+		if len(chunk) < SEND_FILE_LEN {
+			return nil
+		}
+	}
+}
+
+// expectOP checks that the last received TX has opcode op. OP_BUSY and
+// OP_NACK answers are reported as ErrNodeBusy and ErrNodeRejected.
+func (m *SocketData) expectOP(op uint16) error {
+	got := binary.LittleEndian.Uint16(m.recv_tx.Opcode[:])
+	switch got {
+	case op:
+		return nil
+	case OP_BUSY:
+		return ErrNodeBusy
+	case OP_NACK:
+		return ErrNodeRejected
+	}
+	return &ErrUnexpectedOpcode{Got: got, Want: op}
 }
 
 // Copy ID2 from recv_tx to send_tx
@@ -309,38 +488,84 @@ func (m *SocketData) copyID2() {
 
 // Connnect and send OP_HELLO and wait for OP_HELLO_ACK
 func (m *SocketData) Hello() error {
+	return m.HelloContext(context.Background())
+}
+
+// Connnect and send OP_HELLO and wait for OP_HELLO_ACK, giving up when ctx is done
+func (m *SocketData) HelloContext(ctx context.Context) error {
 	// Connect to the IP
-	m.Connect()
+	err := m.ConnectContext(ctx)
+	if err != nil {
+		return err
+	}
 	// Send OP_HELLO
-	err := m.SendOP(OP_HELLO)
+	err = m.SendOPContext(ctx, OP_HELLO)
 	if err != nil {
 		return err
 	}
 	//fmt.Println("Sent OP_HELLO")
 	// Receive TX struct
-	err = m.recvTX()
+	err = m.recvTX(ctx)
 	//fmt.Println("Received TX struct")
 	if err != nil {
 		return err
 	}
 	// Check if opcode is OP_HELLO_ACK
-	if m.recv_tx.Opcode[0] != byte(OP_HELLO_ACK) {
-		return fmt.Errorf("opcode is not OP_HELLO_ACK")
+	if err := m.expectOP(OP_HELLO_ACK); err != nil {
+		return err
 	}
 	// Copy ID2 from recv_tx to send_tx
 	m.copyID2()
+	m.pversion = m.recv_tx.GetVersion()
 	return nil
 }
 
 func ConnectToNode(ip string) SocketData {
+	return DefaultClient.ConnectToNode(ip)
+}
+
+// ConnectToNodeContext connects to ip and performs the handshake. The
+// connection is closed if the handshake fails.
+func ConnectToNodeContext(ctx context.Context, ip string) (SocketData, error) {
+	return DefaultClient.ConnectToNodeContext(ctx, ip)
+}
+
+// ConnectToNode connects to ip with the client dialer and timeouts
+func (c *Client) ConnectToNode(ip string) SocketData {
+	sd, err := c.ConnectToNodeContext(context.Background(), ip)
+	if err != nil {
+		c.logger().Warn("handshake failed", "node", ip, "error", err)
+	}
+	return sd
+}
+
+// ConnectToNodeContext is ConnectToNode giving up when ctx is done. The
+// connection is closed if the handshake fails.
+func (c *Client) ConnectToNodeContext(ctx context.Context, ip string) (SocketData, error) {
 	var sd SocketData
 	sd.IP = ip
 	sd.send_tx = NewTX(nil)
-	err := sd.Hello()
+	sd.dialer = c.Dialer
+	sd.read_timeout = c.ReadTimeout
+	sd.write_timeout = c.WriteTimeout
+	sd.logger = c.logger().With("node", ip)
+	err := sd.HelloContext(ctx)
 	if err != nil {
-		fmt.Println("Error:", err)
+		sd.Close()
+		sd.block_num = 0
+		return sd, &ErrConnect{IP: ip, Err: err}
 	}
-	return sd
+	return sd, nil
+}
+
+// Close the connection to the node
+func (m *SocketData) Close() error {
+	if m.Conn == nil {
+		return nil
+	}
+	err := m.Conn.Close()
+	m.Conn = nil
+	return err
 }
 
 // main function
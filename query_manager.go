@@ -1,10 +1,13 @@
 package go_mcminterface
 
 import (
+	"context"
 	"crypto/sha256"
 	"embed"
+	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math"
 	"math/rand"
@@ -18,6 +21,9 @@ var Settings SettingsType
 // location of settings
 var Settings_file = "settings.json"
 
+// defaults of LoadDefaultSettings
+//
+//go:embed settings.json
 var settingsFS embed.FS
 
 // Global settings
@@ -26,16 +32,18 @@ type SettingsType struct {
 	IPs                []string
 	Nodes              []RemoteNode
 	IPExpandDepth      int
-	ForceQueryStartIPs bool // Forces to query only start ips bypassing PickNodes
-	QuerySize          int  // Number of nodes to query, quorum is 50% + 1
-	QueryTimeout       int  // Timeout in seconds
-	MaxQueryAttempts   int  // Maximum number of attempts to query a block
+	ForceQueryStartIPs bool   // Forces to query only start ips bypassing PickNodes
+	QuerySize          int    // Number of nodes to query, quorum is 50% + 1
+	QueryTimeout       int    // Timeout in seconds
+	MaxQueryAttempts   int    // Maximum number of attempts to query a block
+	V3Block            uint64 // First block of the v3 format, a neo-genesis block; 0 until the network upgrades
 }
 
 type RemoteNode struct {
 	IP       string
 	LastSeen time.Time
 	Ping     uint32
+	Identity *NodeIdentity `json:",omitempty"` // set by QueryNodeIdentities
 }
 
 // Load default settings with embed in settings.json
@@ -43,14 +51,14 @@ func LoadDefaultSettings() {
 	// Load default settings from embed
 	data, err := settingsFS.ReadFile("settings.json")
 	if err != nil {
-		fmt.Println("LoadDefaultSettings(): Error reading settings.json:", err)
+		DefaultClient.logger().Warn("cannot read default settings", "error", err)
 		return
 	}
 
 	var settings SettingsType
 	err = json.Unmarshal(data, &settings)
 	if err != nil {
-		fmt.Println("LoadDefaultSettings(): Error decoding settings.json:", err)
+		DefaultClient.logger().Warn("cannot decode default settings", "error", err)
 		return
 	}
 
@@ -66,7 +74,7 @@ func LoadSettings(paths ...string) SettingsType {
 		// set to user config dir
 		dir, err := os.UserConfigDir()
 		if err != nil {
-			fmt.Println("Error getting user config dir:", err)
+			DefaultClient.logger().Warn("cannot get user config dir", "error", err)
 			return Settings
 		}
 		path = dir + "/mcminterface/settings.json"
@@ -81,7 +89,7 @@ func LoadSettings(paths ...string) SettingsType {
 	// Load settings from path
 	data, err := os.ReadFile(path)
 	if err != nil {
-		fmt.Println("Error reading settings.json:", err)
+		DefaultClient.logger().Warn("cannot read settings, using defaults", "path", path, "error", err)
 		LoadDefaultSettings()
 		return Settings
 	}
@@ -89,7 +97,7 @@ func LoadSettings(paths ...string) SettingsType {
 	var settings SettingsType
 	err = json.Unmarshal(data, &settings)
 	if err != nil {
-		fmt.Println("Error decoding settings.json:", err)
+		DefaultClient.logger().Warn("cannot decode settings, using defaults", "path", path, "error", err)
 		LoadDefaultSettings()
 		return Settings
 	}
@@ -102,7 +110,7 @@ func LoadSettings(paths ...string) SettingsType {
 func SaveSettings(settings SettingsType) {
 	file, err := os.Create(Settings_file)
 	if err != nil {
-		fmt.Println("Error creating settings.json")
+		DefaultClient.logger().Warn("cannot create settings file", "path", Settings_file, "error", err)
 	}
 	defer file.Close()
 	// format with indentation
@@ -111,36 +119,36 @@ func SaveSettings(settings SettingsType) {
 	err = encoder.Encode(settings)
 
 	if err != nil {
-		fmt.Println("Error encoding settings.json")
+		DefaultClient.logger().Warn("cannot encode settings", "path", Settings_file, "error", err)
 	}
 }
 
 // Expand known IPs
-func ExpandIPs() {
+func (c *Client) ExpandIPs() {
 	// Add start IPs to the settings IPs
-	Settings.IPs = append(Settings.IPs, Settings.StartIPs...)
+	c.Settings.IPs = append(c.Settings.IPs, c.Settings.StartIPs...)
 	queriedIPs := make(map[string]bool)
 
-	for i := 0; i < Settings.IPExpandDepth; i++ {
+	for i := 0; i < c.Settings.IPExpandDepth; i++ {
 		ips := make([]string, 0)
 		ch := make(chan string)
 
-		for _, ip := range Settings.IPs {
+		for _, ip := range c.Settings.IPs {
 			if queriedIPs[ip] {
 				continue // Skip already queried IPs
 			}
 			queriedIPs[ip] = true
 
 			go func(ip string) {
-				sd := ConnectToNode(ip)
+				sd := c.ConnectToNode(ip)
 				if sd.block_num == 0 {
-					fmt.Println("Connection failed")
 					ch <- ""
 					return
 				}
+				defer sd.Close()
 				new_ips, err := sd.GetIPList()
 				if err != nil {
-					fmt.Println("Error:", err)
+					c.logger().Debug("cannot get ip list", "node", ip, "error", err)
 					ch <- ""
 					return
 				}
@@ -161,75 +169,78 @@ func ExpandIPs() {
 			}(ip)
 		}
 
-		timeout := time.After(time.Duration(Settings.QueryTimeout) * time.Second) // Set timeout of 5 seconds
-		for range Settings.IPs {
+		timeout := time.After(time.Duration(c.Settings.QueryTimeout) * time.Second) // Set timeout of 5 seconds
+		for range c.Settings.IPs {
 			select {
 			case ip := <-ch:
 				if ip != "" {
 					ips = append(ips, ip)
 				}
 			case <-timeout:
-				fmt.Println("Timeout")
+				c.logger().Info("ip expansion timed out", "depth", i)
 				return
 			}
 		}
 
-		Settings.IPs = ips
+		c.Settings.IPs = ips
 	}
 }
 
 // Benchmark all IPs in the time they take to ConnectToNode
-func BenchmarkNodes(n int) {
+func (c *Client) BenchmarkNodes(n int) {
 	ch := make(chan RemoteNode)
 
-	for i := 0; i < len(Settings.IPs); i += n {
+	for i := 0; i < len(c.Settings.IPs); i += n {
 		end := i + n
-		if end > len(Settings.IPs) {
-			end = len(Settings.IPs)
+		if end > len(c.Settings.IPs) {
+			end = len(c.Settings.IPs)
 		}
-		ips := Settings.IPs[i:end]
+		ips := c.Settings.IPs[i:end]
 
 		for _, ip := range ips {
 			go func(ip string) {
 				start := time.Now()
-				sd := ConnectToNode(ip)
+				sd := c.ConnectToNode(ip)
 				ping := time.Since(start)
 				if sd.block_num == 0 {
-					fmt.Println("Connection failed")
 					ping = 10 * time.Second
 				}
+				sd.Close()
+				c.logger().Debug("node benchmarked", "node", ip, "latency", ping)
 				// ping in milliseconds
 				ch <- RemoteNode{IP: ip, Ping: uint32(ping / time.Millisecond)}
 			}(ip)
 		}
 	}
 
-	timeout := time.After(time.Duration(Settings.QueryTimeout) * time.Second)
+	timeout := time.After(time.Duration(c.Settings.QueryTimeout) * time.Second)
 
-	for i := 0; i < len(Settings.IPs); i += n {
+	for i := 0; i < len(c.Settings.IPs); i += n {
 		end := i + n
-		if end > len(Settings.IPs) {
-			end = len(Settings.IPs)
+		if end > len(c.Settings.IPs) {
+			end = len(c.Settings.IPs)
 		}
-		ips := Settings.IPs[i:end]
+		ips := c.Settings.IPs[i:end]
 
 		for range ips {
 			select {
 			case node := <-ch:
+				c.nodes_mu.Lock()
 				found := false
-				for i, n := range Settings.Nodes {
+				for i, n := range c.Settings.Nodes {
 					if n.IP == node.IP {
-						Settings.Nodes[i].Ping = (n.Ping*2 + node.Ping) / 3
-						Settings.Nodes[i].LastSeen = time.Now()
+						c.Settings.Nodes[i].Ping = (n.Ping*2 + node.Ping) / 3
+						c.Settings.Nodes[i].LastSeen = time.Now()
 						found = true
 						break
 					}
 				}
 				if !found {
-					Settings.Nodes = append(Settings.Nodes, node)
+					c.Settings.Nodes = append(c.Settings.Nodes, node)
 				}
+				c.nodes_mu.Unlock()
 			case <-timeout:
-				fmt.Println("Timeout")
+				c.logger().Info("benchmark timed out")
 				return
 			}
 		}
@@ -238,36 +249,57 @@ func BenchmarkNodes(n int) {
 	close(ch)
 }
 
-// Pick n random nodes from Settings.Nodes
-// the probability of picking a node is e**(-ping)
-func PickNodes(n int) []RemoteNode {
+// nodeWeight returns the weight of node in PickNodes: e**(-ping), reduced by
+// OUTDATED_NODE_WEIGHT if the node speaks an older protocol than newest
+func nodeWeight(node RemoteNode, newest int) float64 {
+	weight := math.Exp(-1 / float64(node.Ping/2))
+	if node.Identity != nil && node.Identity.ProtocolVersion < newest {
+		weight *= OUTDATED_NODE_WEIGHT
+	}
+	return weight
+}
+
+// Nodes returns a copy of the client Settings.Nodes, which BenchmarkNodes
+// and QueryNodeIdentities update while queries pick nodes
+func (c *Client) Nodes() []RemoteNode {
+	c.nodes_mu.RLock()
+	defer c.nodes_mu.RUnlock()
+
+	return append([]RemoteNode(nil), c.Settings.Nodes...)
+}
+
+// Pick n random nodes from the client Settings.Nodes
+// the probability of picking a node is e**(-ping), lower for outdated nodes
+func (c *Client) PickNodes(n int) []RemoteNode {
+	all := c.Nodes()
 	// if forcequerystartips is set, return the nodes with ip startip
-	if Settings.ForceQueryStartIPs {
+	if c.Settings.ForceQueryStartIPs {
 		nodes := make([]RemoteNode, 0)
-		for _, node := range Settings.Nodes {
-			if node.IP == Settings.StartIPs[0] {
+		for _, node := range all {
+			if node.IP == c.Settings.StartIPs[0] {
 				nodes = append(nodes, node)
 			}
 		}
 		return nodes
 	}
 
-	if n >= len(Settings.Nodes) {
-		return Settings.Nodes
+	if n >= len(all) {
+		return all
 	}
 
+	newest := newestVersion(all)
 	nodes := make([]RemoteNode, 0)
 	for i := 0; i < n; i++ {
 		// calculate the sum of e**(-ping) for all nodes
 		sum := 0.0
-		for _, node := range Settings.Nodes {
-			sum += math.Exp(-1 / float64(node.Ping/2))
+		for _, node := range all {
+			sum += nodeWeight(node, newest)
 		}
 		// pick a random number between 0 and sum
 		r := sum * rand.Float64()
 		// find the node that corresponds to the random number
-		for _, node := range Settings.Nodes {
-			r -= math.Exp(-1 / float64(node.Ping/2))
+		for _, node := range all {
+			r -= nodeWeight(node, newest)
 			if r <= 0 {
 				// if it is already in the list, decrease i and continue
 				found := false
@@ -288,150 +320,217 @@ func PickNodes(n int) []RemoteNode {
 	return nodes
 }
 
-// Query the balance of an address given as hex
-func QueryBalance(wots_address string) (uint64, error) {
-	wots_addr := WotsAddressFromHex(wots_address)
+// Backoff before retrying a request a node answered with OP_BUSY
+const (
+	BUSY_BACKOFF     = 250 * time.Millisecond
+	BUSY_BACKOFF_MAX = 4 * time.Second
+)
 
-	// connect to a random node
-	nodes := PickNodes(Settings.QuerySize)
-	balances := make([]WotsAddress, 0)
+// busyBackoff returns the wait before the retry number attempt (from 0) of a
+// busy request: BUSY_BACKOFF doubled at each attempt, with jitter
+func busyBackoff(attempt int) time.Duration {
+	backoff := BUSY_BACKOFF_MAX
+	if attempt < 4 {
+		backoff = BUSY_BACKOFF << attempt
+	}
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)))
+}
+
+// sleepContext waits for d, returning false if ctx is done before
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
 
-	// Ask for result on the same time
-	ch := make(chan WotsAddress)
+// queryNode connects to node and runs query on the connection
+func queryNode[T any](ctx context.Context, c *Client, node RemoteNode, query func(ctx context.Context, sd *SocketData) (T, error)) (T, error) {
+	start := time.Now()
+	sd, err := c.ConnectToNodeContext(ctx, node.IP)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	defer sd.Close()
+	value, err := query(ctx, &sd)
+	c.logger().Debug("node answered", "node", node.IP, "latency", time.Since(start), "error", err)
+	return value, err
+}
 
+// queryNodes runs query against every node concurrently, each on its own
+// connection, and returns the answers that arrived within the client QueryTimeout.
+// Pending connections are aborted as soon as the timeout expires or ctx is
+// cancelled; in the latter case ctx.Err() is returned.
+// A node answering OP_BUSY is not counted as failed: after a backoff the
+// request is retried on a node not queried yet, up to MaxQueryAttempts times.
+func queryNodes[T any](ctx context.Context, c *Client, nodes []RemoteNode, query func(ctx context.Context, sd *SocketData) (T, error)) ([]T, error) {
+	var query_ctx context.Context
+	var cancel context.CancelFunc
+	if c.Settings.QueryTimeout > 0 {
+		query_ctx, cancel = context.WithTimeout(ctx, time.Duration(c.Settings.QueryTimeout)*time.Second)
+	} else {
+		query_ctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	// nodes already queried, busy ones are replaced by the others
+	var mu sync.Mutex
+	queried := make(map[string]bool)
 	for _, node := range nodes {
-		go func(node RemoteNode) {
-			sd := ConnectToNode(node.IP)
-			if sd.block_num == 0 {
-				fmt.Println("Connection failed")
-				ch <- WotsAddress{}
-				return
+		queried[node.IP] = true
+	}
+	candidates := c.PickNodes(len(c.Settings.Nodes))
+	replacement := func(busy RemoteNode) RemoteNode {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, i := range rand.Perm(len(candidates)) {
+			if !queried[candidates[i].IP] {
+				queried[candidates[i].IP] = true
+				return candidates[i]
 			}
-			// get the balance of the wots_addr GetBalance
-			balance, err := sd.GetBalance(wots_addr)
-			if err != nil {
-				fmt.Println("Error:", err)
-				ch <- WotsAddress{}
-				return
+		}
+		// every node was queried, try the busy one again
+		return busy
+	}
+
+	type reply struct {
+		value T
+		err   error
+	}
+	// buffered so that late goroutines never block
+	ch := make(chan reply, len(nodes))
+
+	for _, node := range nodes {
+		go func(node RemoteNode) {
+			for attempt := 0; ; attempt++ {
+				value, err := queryNode(query_ctx, c, node, query)
+				if !errors.Is(err, ErrNodeBusy) || attempt >= c.Settings.MaxQueryAttempts {
+					if err != nil {
+						c.logger().Warn("node query failed", "node", node.IP, "error", err)
+					}
+					ch <- reply{value: value, err: err}
+					return
+				}
+				c.logger().Info("node busy, retrying elsewhere", "node", node.IP, "attempt", attempt+1)
+				if !sleepContext(query_ctx, busyBackoff(attempt)) {
+					ch <- reply{err: query_ctx.Err()}
+					return
+				}
+				node = replacement(node)
 			}
-			wots_addr.Amount = balance
-			ch <- wots_addr
 		}(node)
 	}
 
-	timeout := time.After(time.Duration(Settings.QueryTimeout) * time.Second)
+	values := make([]T, 0, len(nodes))
+collect:
 	for range nodes {
 		select {
-		case balance := <-ch:
-			if balance.Amount != 0 {
-				balances = append(balances, balance)
+		case r := <-ch:
+			if r.err == nil {
+				values = append(values, r.value)
 			}
-		case <-timeout:
-			fmt.Println("Timeout")
-			//return 0, fmt.Errorf("timeout")
+		case <-query_ctx.Done():
+			c.logger().Info("query timed out", "queried", len(nodes), "answers", len(values))
+			break collect
 		}
 	}
 
-	close(ch)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
 
-	// Calculate the most frequent balance
-	counts := make(map[uint64]int)
-	for _, balance := range balances {
-		counts[balance.Amount]++
+// quorum returns the value reported by at least query_size/2+1 nodes, or an
+// *ErrNoQuorum holding the votes of the most common value
+func quorum[K comparable](what string, values []K, queried int, query_size int) (K, error) {
+	counts := make(map[K]int)
+	for _, value := range values {
+		counts[value]++
+	}
+	needed := query_size/2 + 1
+	best := 0
+	for value, count := range counts {
+		if count >= needed {
+			return value, nil
+		}
+		best = max(best, count)
 	}
+	var zero K
+	return zero, &ErrNoQuorum{What: what, Queried: queried, Responses: len(values), Votes: best, Needed: needed}
+}
 
-	// See if there is a balance that reaches quorum
+// Query the balance of an address given as hex
+func (c *Client) QueryBalance(wots_address string) (uint64, error) {
+	return c.QueryBalanceContext(context.Background(), wots_address)
+}
+
+// Query the balance of an address given as hex, giving up when ctx is done
+func (c *Client) QueryBalanceContext(ctx context.Context, wots_address string) (uint64, error) {
+	wots_addr := WotsAddressFromHex(wots_address)
 
-	max_balance := uint64(0)
-	for balance, count := range counts {
-		if count >= Settings.QuerySize/2+1 {
-			max_balance = balance
-			break
+	// Ask for result on the same time to random nodes
+	nodes := c.PickNodes(c.Settings.QuerySize)
+	balances, err := queryNodes(ctx, c, nodes, func(ctx context.Context, sd *SocketData) (uint64, error) {
+		// get the balance of the wots_addr GetBalance
+		balance, err := sd.GetBalanceContext(ctx, wots_addr)
+		// a node not finding the address is an answer too
+		if errors.Is(err, ErrAddressNotFound) {
+			return 0, nil
 		}
+		return balance, err
+	})
+	if err != nil {
+		return 0, err
 	}
 
-	// If no balance reaches quorum, return 0
+	// See if there is a balance that reaches quorum
+	max_balance, err := quorum("balance", balances, len(nodes), c.Settings.QuerySize)
+	if err != nil {
+		return 0, err
+	}
+	// The ledger never holds empty addresses
 	if max_balance == 0 {
-		return 0, fmt.Errorf("no balance reaches quorum")
+		return 0, ErrAddressNotFound
 	}
 
-	// Save the most frequent balance to the wots_address
-	wots_addr.Amount = max_balance
-	//fmt.Println("Wots address:", wots_addr)
-
 	return max_balance, nil
 }
 
 // QueryBlockHash queries the block hash (HASHLEN) of a block number
 // if block number is 0, it returns the hash of the last block.
-func QueryBlockHash(block_num uint64) ([HASHLEN]byte, error) {
-	// connect to a random node
-	nodes := PickNodes(Settings.QuerySize)
-	hashes := make([][HASHLEN]byte, 0)
-
-	// Ask for result on the same time
-	ch := make(chan [HASHLEN]byte)
-	var wg sync.WaitGroup
-
-	for _, node := range nodes {
-		wg.Add(1)
-		go func(node RemoteNode) {
-			defer wg.Done()
-			sd := ConnectToNode(node.IP)
-			if sd.block_num == 0 {
-				fmt.Println("Connection failed")
-				ch <- [HASHLEN]byte{}
-				return
-			}
-			// get the block hash
-			hash, err := sd.GetBlockHash(block_num)
-			if err != nil {
-				fmt.Println("Error:", err)
-				ch <- [HASHLEN]byte{}
-				return
-			}
-			ch <- hash
-		}(node)
-	}
-
-	go func() {
-		wg.Wait()
-		close(ch)
-	}()
-
-	timeout := time.After(time.Duration(Settings.QueryTimeout) * time.Second)
+func (c *Client) QueryBlockHash(block_num uint64) ([HASHLEN]byte, error) {
+	return c.QueryBlockHashContext(context.Background(), block_num)
+}
 
-	for range nodes {
-		select {
-		case hash := <-ch:
-			if hash != [HASHLEN]byte{} {
-				hashes = append(hashes, hash)
-			}
-		case <-timeout:
-			fmt.Println("Timeout triggered")
-			// stop the goroutines
-			//return [HASHLEN]byte{}, fmt.Errorf("timeout")
-		}
+// QueryBlockHashContext is QueryBlockHash giving up when ctx is done
+func (c *Client) QueryBlockHashContext(ctx context.Context, block_num uint64) ([HASHLEN]byte, error) {
+	// Ask for result on the same time to random nodes
+	nodes := c.PickNodes(c.Settings.QuerySize)
+	hashes, err := queryNodes(ctx, c, nodes, func(ctx context.Context, sd *SocketData) ([HASHLEN]byte, error) {
+		return sd.GetBlockHashContext(ctx, block_num)
+	})
+	if err != nil {
+		return [HASHLEN]byte{}, err
 	}
 
-	// Calculate the most frequent hash
-	counts := make(map[[HASHLEN]byte]int)
+	// Empty hashes never count towards the quorum
+	non_zero := make([][HASHLEN]byte, 0, len(hashes))
 	for _, hash := range hashes {
-		counts[hash]++
-	}
-
-	// See if there is a hash that reaches quorum
-	var max_hash [HASHLEN]byte
-	for hash, count := range counts {
-		if count >= Settings.QuerySize/2+1 {
-			max_hash = hash
-			break
+		if hash != [HASHLEN]byte{} {
+			non_zero = append(non_zero, hash)
 		}
 	}
 
-	// If no hash reaches quorum, return 0
-	if max_hash == [HASHLEN]byte{} {
-		return [HASHLEN]byte{}, fmt.Errorf("no hash reaches quorum")
+	// See if there is a hash that reaches quorum
+	max_hash, err := quorum("hash", non_zero, len(nodes), c.Settings.QuerySize)
+	if err != nil {
+		return [HASHLEN]byte{}, err
 	}
 
 	return max_hash, nil
@@ -439,278 +538,246 @@ func QueryBlockHash(block_num uint64) ([HASHLEN]byte, error) {
 
 // QueryBlockBytes
 // 1. Gets the block hash 2. Gets the block bytes from a random node until the hash matches
-func QueryBlockBytes(block_num uint64) ([]byte, error) {
+func (c *Client) QueryBlockBytes(block_num uint64) ([]byte, error) {
+	return c.QueryBlockBytesContext(context.Background(), block_num)
+}
+
+// QueryBlockBytesContext is QueryBlockBytes giving up when ctx is done
+func (c *Client) QueryBlockBytesContext(ctx context.Context, block_num uint64) ([]byte, error) {
 	// get the block hash
-	hash, err := QueryBlockHash(block_num)
+	hash, err := c.QueryBlockHashContext(ctx, block_num)
 	if err != nil {
 		return nil, err
 	}
+	return c.queryBlockMatching(ctx, block_num, hash, false)
+}
 
-	found := false
-	attempts := 0
-	var block []byte
-	for !found {
-		// connect to one random node
-		nodes := PickNodes(1)
-		node := nodes[0]
-		sd := ConnectToNode(node.IP)
-		if sd.block_num == 0 {
-			fmt.Println("Connection failed")
-			// try again with another node
-			continue
+// QueryGenesisBlock downloads block 0, the genesis block, checked against its
+// trailer agreed by the network. Block 0 means the latest block in the other
+// block queries.
+func (c *Client) QueryGenesisBlock() (Block, error) {
+	return c.QueryGenesisBlockContext(context.Background())
+}
+
+// QueryGenesisBlockContext is QueryGenesisBlock giving up when ctx is done
+func (c *Client) QueryGenesisBlockContext(ctx context.Context) (Block, error) {
+	trailers, err := c.QueryBTrailersContext(ctx, 0, 1)
+	if err != nil {
+		return Block{}, err
+	}
+	if len(trailers) != 1 || binary.LittleEndian.Uint64(trailers[0].Bnum[:]) != 0 {
+		return Block{}, fmt.Errorf("no trailer for the genesis block")
+	}
+	bytes, err := c.queryBlockMatching(ctx, 0, trailers[0].Bhash, true)
+	if err != nil {
+		return Block{}, err
+	}
+	block, err := ParseBlock(bytes)
+	if err != nil {
+		return Block{}, err
+	}
+	if err := block.Verify(); err != nil {
+		return Block{}, err
+	}
+	return block, nil
+}
+
+// queryBlockMatching downloads block_num from random nodes until its bytes
+// hash to hash. Unless genesis, block 0 is the latest block of the node.
+func (c *Client) queryBlockMatching(ctx context.Context, block_num uint64, hash [HASHLEN]byte, genesis bool) ([]byte, error) {
+	for attempts := 0; attempts <= c.Settings.MaxQueryAttempts; attempts++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
 		}
-		// if block number is 0, get the latest block
-		if block_num == 0 {
-			block_num = sd.block_num
+		// connect to one random node
+		nodes := c.PickNodes(1)
+		if len(nodes) == 0 {
+			return nil, fmt.Errorf("no nodes available")
 		}
-		// get the block bytes
-		block, err = sd.GetBlockBytes(block_num)
+		block, err := c.downloadBlock(ctx, nodes[0], block_num, genesis)
 		if err != nil {
-			fmt.Println("Error:", err)
+			c.logger().Warn("block download failed", "node", nodes[0].IP, "block", block_num, "error", err)
+			// a busy node is not broken, give the network some time
+			if errors.Is(err, ErrNodeBusy) && !sleepContext(ctx, busyBackoff(attempts)) {
+				return nil, ctx.Err()
+			}
+			// try again with another node
 			continue
 		}
 		// check if the sha256 matches the bytes[:-HASHLEN]
-		sha256_hash := sha256.Sum256(block[:len(block)-HASHLEN])
-		if sha256_hash == hash {
-			found = true
-		}
-		attempts++
-		if attempts > Settings.MaxQueryAttempts {
-			return nil, fmt.Errorf("max query attempts reached")
+		if len(block) >= HASHLEN && sha256.Sum256(block[:len(block)-HASHLEN]) == hash {
+			return block, nil
 		}
 	}
-	return block, nil
+	return nil, fmt.Errorf("max query attempts reached")
+}
+
+// downloadBlock fetches the bytes of block_num from node, or its latest block
+// if block_num is 0 and not genesis
+func (c *Client) downloadBlock(ctx context.Context, node RemoteNode, block_num uint64, genesis bool) ([]byte, error) {
+	sd, err := c.ConnectToNodeContext(ctx, node.IP)
+	if err != nil {
+		return nil, err
+	}
+	defer sd.Close()
+	// if block number is 0, get the latest block
+	if block_num == 0 && !genesis {
+		block_num = sd.block_num
+	}
+	// get the block bytes
+	return sd.GetBlockBytesContext(ctx, block_num)
 }
 
 // QueryBlockFromNumber
-func QueryBlockFromNumber(block_num uint64) (Block, error) {
+func (c *Client) QueryBlockFromNumber(block_num uint64) (Block, error) {
+	return c.QueryBlockFromNumberContext(context.Background(), block_num)
+}
+
+// QueryBlockFromNumberContext is QueryBlockFromNumber giving up when ctx is done
+func (c *Client) QueryBlockFromNumberContext(ctx context.Context, block_num uint64) (Block, error) {
 	// get the block bytes
-	block_bytes, err := QueryBlockBytes(block_num)
+	block_bytes, err := c.QueryBlockBytesContext(ctx, block_num)
 	if err != nil {
 		return Block{}, err
 	}
+	// v3 blocks have their own layout
+	if c.IsV3Block(block_num) || IsBlockV3(block_bytes) {
+		return Block{}, fmt.Errorf("block %d is in the v3 format, see QueryBlockV3FromNumber", block_num)
+	}
 	// create the block from the bytes
-	block := BlockFromBytes(block_bytes)
+	block, err := ParseBlock(block_bytes)
+	if err != nil {
+		return Block{}, err
+	}
+	// the body must match the trailer
+	if err := block.Verify(); err != nil {
+		return Block{}, err
+	}
 	return block, nil
 }
 
-// QueryTagResolve queries the tag resolve
-func QueryTagResolve(tag []byte) (WotsAddress, error) {
-	// connect to a random node
-	nodes := PickNodes(Settings.QuerySize)
-	addresses := make([]WotsAddress, 0)
-
-	// Ask for result on the same time
-	ch := make(chan WotsAddress)
+// QueryBlockV3FromNumber downloads a block in the v3 format
+func (c *Client) QueryBlockV3FromNumber(block_num uint64) (BlockV3, error) {
+	return c.QueryBlockV3FromNumberContext(context.Background(), block_num)
+}
 
-	for _, node := range nodes {
-		go func(node RemoteNode) {
-			sd := ConnectToNode(node.IP)
-			if sd.block_num == 0 {
-				fmt.Println("Connection failed")
-				ch <- WotsAddress{}
-				return
-			}
-			// get the address from the tag
-			addr, err := sd.ResolveTag(tag)
-			if err != nil {
-				fmt.Println("Error:", err)
-				ch <- WotsAddress{}
-				return
-			}
-			ch <- addr
-		}(node)
+// QueryBlockV3FromNumberContext is QueryBlockV3FromNumber giving up when ctx is done
+func (c *Client) QueryBlockV3FromNumberContext(ctx context.Context, block_num uint64) (BlockV3, error) {
+	// the bytes match the hash agreed by the network
+	block_bytes, err := c.QueryBlockBytesContext(ctx, block_num)
+	if err != nil {
+		return BlockV3{}, err
 	}
-
-	timeout := time.After(time.Duration(Settings.QueryTimeout) * time.Second)
-
-	for range nodes {
-		select {
-		case addr := <-ch:
-			if addr.Amount != 0 {
-				addresses = append(addresses, addr)
-			}
-		case <-timeout:
-			fmt.Println("Timeout")
-			//return WotsAddress{}, fmt.Errorf("timeout")
-		}
+	// pseudo-blocks are the same in both formats
+	if !c.IsV3Block(block_num) && !IsBlockV3(block_bytes) && BlockTypeV3(block_bytes) != BLOCK_PSEUDO {
+		return BlockV3{}, fmt.Errorf("block %d is not in the v3 format, see QueryBlockFromNumber", block_num)
 	}
+	return BlockV3FromBytes(block_bytes)
+}
 
-	close(ch)
-
-	// Calculate the most frequent address
-	counts := make(map[WotsAddress]int)
-	for _, addr := range addresses {
-		counts[addr]++
-	}
+// IsV3Block tells if block bnum is in the v3 format, from Settings.V3Block
+func (c *Client) IsV3Block(bnum uint64) bool {
+	return c.Settings.V3Block != 0 && bnum >= c.Settings.V3Block
+}
 
-	// See if there is an address that reaches quorum
+// QueryTagResolve queries the tag resolve
+func (c *Client) QueryTagResolve(tag []byte) (WotsAddress, error) {
+	return c.QueryTagResolveContext(context.Background(), tag)
+}
 
-	var max_addr WotsAddress
-	for addr, count := range counts {
-		if count >= Settings.QuerySize/2+1 {
-			max_addr = addr
-			break
+// QueryTagResolveContext is QueryTagResolve giving up when ctx is done
+func (c *Client) QueryTagResolveContext(ctx context.Context, tag []byte) (WotsAddress, error) {
+	// Ask for result on the same time to random nodes
+	nodes := c.PickNodes(c.Settings.QuerySize)
+	addresses, err := queryNodes(ctx, c, nodes, func(ctx context.Context, sd *SocketData) (WotsAddress, error) {
+		// get the address from the tag
+		addr, err := sd.ResolveTagContext(ctx, tag)
+		// a node not finding the tag is an answer too
+		if errors.Is(err, ErrTagNotFound) {
+			return WotsAddress{}, nil
 		}
+		return addr, err
+	})
+	if err != nil {
+		return WotsAddress{}, err
 	}
 
-	// If no address reaches quorum, return 0
+	// See if there is an address that reaches quorum
+	max_addr, err := quorum("address", addresses, len(nodes), c.Settings.QuerySize)
+	if err != nil {
+		return WotsAddress{}, err
+	}
+	// The ledger never holds empty addresses
 	if max_addr.Amount == 0 {
-		return WotsAddress{}, fmt.Errorf("no address reaches quorum")
+		return WotsAddress{}, ErrTagNotFound
 	}
 
 	return max_addr, nil
 }
 
 // QueryTagResolveHex
-func QueryTagResolveHex(tag_hex string) (WotsAddress, error) {
+func (c *Client) QueryTagResolveHex(tag_hex string) (WotsAddress, error) {
+	return c.QueryTagResolveHexContext(context.Background(), tag_hex)
+}
+
+// QueryTagResolveHexContext is QueryTagResolveHex giving up when ctx is done
+func (c *Client) QueryTagResolveHexContext(ctx context.Context, tag_hex string) (WotsAddress, error) {
 	tag, err := hex.DecodeString(tag_hex)
 	if err != nil {
 		return WotsAddress{}, err
 	}
-	return QueryTagResolve(tag)
+	return c.QueryTagResolveContext(ctx, tag)
 }
 
 // QueryLatestBlockNumber
-func QueryLatestBlockNumber() (uint64, error) {
-	// connect to a random node
-	nodes := PickNodes(Settings.QuerySize)
-	block_numbers := make([]uint64, 0)
-
-	// Ask for result on the same time
-	ch := make(chan uint64)
-	var wg sync.WaitGroup
-
-	for _, node := range nodes {
-		wg.Add(1)
-		go func(node RemoteNode) {
-			defer wg.Done()
-			sd := ConnectToNode(node.IP)
-			if sd.block_num == 0 {
-				fmt.Println("Connection failed")
-				ch <- 0
-				return
-			}
-			// get the latest block number
-			ch <- sd.block_num
-		}(node)
-	}
-
-	go func() {
-		wg.Wait()
-		close(ch)
-	}()
-
-	timeout := time.After(time.Duration(Settings.QueryTimeout) * time.Second)
-
-	for range nodes {
-		select {
-		case block_num := <-ch:
-			if block_num != 0 {
-				block_numbers = append(block_numbers, block_num)
-			}
-		case <-timeout:
-			fmt.Println("Timeout")
-			//return 0, fmt.Errorf("timeout")
-		}
-	}
+func (c *Client) QueryLatestBlockNumber() (uint64, error) {
+	return c.QueryLatestBlockNumberContext(context.Background())
+}
 
-	// Calculate the most frequent block number
-	counts := make(map[uint64]int)
-	for _, block_num := range block_numbers {
-		counts[block_num]++
+// QueryLatestBlockNumberContext is QueryLatestBlockNumber giving up when ctx is done
+func (c *Client) QueryLatestBlockNumberContext(ctx context.Context) (uint64, error) {
+	// Ask for result on the same time to random nodes
+	nodes := c.PickNodes(c.Settings.QuerySize)
+	block_numbers, err := queryNodes(ctx, c, nodes, func(ctx context.Context, sd *SocketData) (uint64, error) {
+		// the latest block number comes with the handshake
+		return sd.block_num, nil
+	})
+	if err != nil {
+		return 0, err
 	}
 
 	// See if there is a block number that reaches quorum
-	var max_block_num uint64
-	for block_num, count := range counts {
-		if count >= Settings.QuerySize/2+1 {
-			max_block_num = block_num
-			break
-		}
-	}
-
-	// If no block number reaches quorum, return 0
-	if max_block_num == 0 {
-		return 0, fmt.Errorf("no block number reaches quorum")
+	max_block_num, err := quorum("block number", block_numbers, len(nodes), c.Settings.QuerySize)
+	if err != nil {
+		return 0, err
 	}
 
 	return max_block_num, nil
 }
 
 // QueryBTrailers using GetTrailersBytes
-func queryBTrailers(start_block uint32, count uint32) ([]BTRAILER, error) {
-	nodes := PickNodes(Settings.QuerySize)
-	trailers_bytes := make([][]byte, 0)
-
-	// Ask for result on the same time
-	ch := make(chan []byte)
-	var wg sync.WaitGroup
-
-	for _, node := range nodes {
-		wg.Add(1)
-		go func(node RemoteNode) {
-			defer wg.Done()
-			sd := ConnectToNode(node.IP)
-			if sd.block_num == 0 {
-				fmt.Println("Connection failed")
-				ch <- nil
-				return
-			}
-			// get the trailers bytes
-			tf_bytes, err := sd.GetTrailersBytes(start_block, count)
-			if err != nil {
-				fmt.Println("Error:", err)
-				ch <- nil
-				return
-			}
-			ch <- tf_bytes
-		}(node)
-	}
-
-	go func() {
-		wg.Wait()
-		close(ch)
-	}()
-
-	timeout := time.After(time.Duration(Settings.QueryTimeout) * time.Second)
-
-	for range nodes {
-		select {
-		case tf_bytes := <-ch:
-			if tf_bytes != nil {
-				trailers_bytes = append(trailers_bytes, tf_bytes)
-			}
-		case <-timeout:
-			fmt.Println("Timeout")
-			//return nil, fmt.Errorf("timeout")
-		}
-	}
-
-	// Calculate the most frequent trailers
-	counts := make(map[string]int)
-	for _, tf_bytes := range trailers_bytes {
-		counts[string(tf_bytes)]++
+func (c *Client) queryBTrailers(ctx context.Context, start_block uint32, count uint32) ([]BTRAILER, error) {
+	// Ask for result on the same time to random nodes
+	nodes := c.PickNodes(c.Settings.QuerySize)
+	trailers_bytes, err := queryNodes(ctx, c, nodes, func(ctx context.Context, sd *SocketData) (string, error) {
+		// get the trailers bytes
+		tf_bytes, err := sd.GetTrailersBytesContext(ctx, start_block, count)
+		return string(tf_bytes), err
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	// See if there is a trailers that reaches quorum
-	var max_tf_bytes []byte
-	for tf_bytes, count := range counts {
-		if count >= Settings.QuerySize/2+1 {
-			max_tf_bytes = []byte(tf_bytes)
-			break
-		}
-	}
-
-	// If no trailers reaches quorum, return 0
-	if max_tf_bytes == nil {
-		return nil, fmt.Errorf("no trailers reaches quorum")
+	max_tf_bytes, err := quorum("trailers", trailers_bytes, len(nodes), c.Settings.QuerySize)
+	if err != nil {
+		return nil, err
 	}
 
 	// Convert the bytes to BTRAILER
 	trailers := make([]BTRAILER, 0)
-	for i := 0; i < len(max_tf_bytes); i += 160 {
-		trailer := bTrailerFromBytes(max_tf_bytes[i : i+160])
+	for i := 0; i+BTRAILER_LEN <= len(max_tf_bytes); i += BTRAILER_LEN {
+		trailer := bTrailerFromBytes([]byte(max_tf_bytes[i : i+BTRAILER_LEN]))
 		trailers = append(trailers, trailer)
 	}
 
@@ -719,7 +786,19 @@ func queryBTrailers(start_block uint32, count uint32) ([]BTRAILER, error) {
 
 // QueryBTrailers queries the block trailers starting from `start_block` and fetches
 // `count` trailers. It splits the request into chunks of 1000 trailers and processes them concurrently.
-func QueryBTrailers(start_block uint32, count uint32) ([]BTRAILER, error) {
+// Past the latest block nodes send fewer trailers, so fewer may be returned.
+// With ValidateTrailers set, the trailers are checked with ValidateTrailerChain
+// and getting fewer than `count` of them is an error.
+func (c *Client) QueryBTrailers(start_block uint32, count uint32) ([]BTRAILER, error) {
+	return c.QueryBTrailersContext(context.Background(), start_block, count)
+}
+
+// QueryBTrailersContext is QueryBTrailers giving up when ctx is done. The
+// first failing chunk cancels the others.
+func (c *Client) QueryBTrailersContext(ctx context.Context, start_block uint32, count uint32) ([]BTRAILER, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	var mu sync.Mutex
 	var wg sync.WaitGroup
 	errCh := make(chan error, 1)
@@ -730,10 +809,11 @@ func QueryBTrailers(start_block uint32, count uint32) ([]BTRAILER, error) {
 
 	queryChunk := func(start uint32, count uint32, index uint32) {
 		defer wg.Done()
-		chunkTrailers, err := queryBTrailers(start, count)
+		chunkTrailers, err := c.queryBTrailers(ctx, start, count)
 		if err != nil {
 			select {
 			case errCh <- err:
+				cancel()
 			default:
 			}
 			return
@@ -776,50 +856,106 @@ func QueryBTrailers(start_block uint32, count uint32) ([]BTRAILER, error) {
 		}
 	}
 
+	if c.ValidateTrailers {
+		if len(trailers) != int(count) {
+			return nil, fmt.Errorf("got %d trailers of the %d requested from block %d", len(trailers), count, start_block)
+		}
+		// the whole list is checked, so the links between chunks are too
+		if len(trailers) > 0 && binary.LittleEndian.Uint64(trailers[0].Bnum[:]) != uint64(start_block) {
+			return nil, &ErrTrailerChain{Index: 0, Block: binary.LittleEndian.Uint64(trailers[0].Bnum[:]), Reason: fmt.Sprintf("expected block %d", start_block)}
+		}
+		if err := ValidateTrailerChain(trailers); err != nil {
+			return nil, err
+		}
+	}
 	return trailers, nil
 }
 
-func SubmitTransaction(tx Transaction) error {
-	// connect to a random node
-	nodes := PickNodes(Settings.QuerySize)
+// SubmitTransaction sends tx to QuerySize nodes and succeeds if at
+// least one of them accepted it
+func (c *Client) SubmitTransaction(tx Transaction) error {
+	return c.SubmitTransactionContext(context.Background(), tx)
+}
 
-	// Ask for result on the same time
-	ch := make(chan error)
+// SubmitTransactionContext is SubmitTransaction giving up when ctx is done
+func (c *Client) SubmitTransactionContext(ctx context.Context, tx Transaction) error {
+	// Ask for result on the same time to random nodes
+	nodes := c.PickNodes(c.Settings.QuerySize)
+	accepted, err := queryNodes(ctx, c, nodes, func(ctx context.Context, sd *SocketData) (bool, error) {
+		// submit the transaction
+		return true, sd.SubmitTransactionContext(ctx, tx)
+	})
+	if err != nil {
+		return err
+	}
 
-	for _, node := range nodes {
-		go func(node RemoteNode) {
-			sd := ConnectToNode(node.IP)
-			if sd.block_num == 0 {
-				fmt.Println("Connection failed")
-				ch <- fmt.Errorf("connection failed")
-				return
-			}
-			// submit the transaction
-			err := sd.SubmitTransaction(tx)
-			if err != nil {
-				fmt.Println("Error:", err)
-				ch <- err
-				return
-			}
-			ch <- nil
-		}(node)
+	if len(accepted) == 0 {
+		return fmt.Errorf("no node accepted the transaction")
 	}
+	return nil
+}
 
-	timeout := time.After(time.Duration(Settings.QueryTimeout) * time.Second)
+// SubmitTransactionV3 sends a v3 transaction to QuerySize nodes. Only the
+// nodes speaking PVERSION3 take it, see SocketData.SubmitTransactionV3.
+func (c *Client) SubmitTransactionV3(tx TransactionV3) error {
+	return c.SubmitTransactionV3Context(context.Background(), tx)
+}
 
-	for range nodes {
-		select {
-		case err := <-ch:
-			if err == nil {
-				return nil
-			}
-		case <-timeout:
-			fmt.Println("Timeout")
-			//return fmt.Errorf("timeout")
-		}
+// SubmitTransactionV3Context is SubmitTransactionV3 giving up when ctx is done
+func (c *Client) SubmitTransactionV3Context(ctx context.Context, tx TransactionV3) error {
+	nodes := c.PickNodes(c.Settings.QuerySize)
+	accepted, err := queryNodes(ctx, c, nodes, func(ctx context.Context, sd *SocketData) (bool, error) {
+		return true, sd.SubmitTransactionV3Context(ctx, tx)
+	})
+	if err != nil {
+		return err
 	}
 
-	close(ch)
+	if len(accepted) == 0 {
+		return fmt.Errorf("no node accepted the v3 transaction")
+	}
+	return nil
+}
+
+// QueryCandidateBlock downloads the candidate block of a random node, i.e. the
+// block it is about to mine. Candidate blocks differ between nodes, so no
+// quorum is involved; the block number is checked against the latest block
+// of the node.
+func (c *Client) QueryCandidateBlock() (Block, error) {
+	return c.QueryCandidateBlockContext(context.Background())
+}
 
-	return fmt.Errorf("no node accepted the transaction")
+// QueryCandidateBlockContext is QueryCandidateBlock giving up when ctx is done
+func (c *Client) QueryCandidateBlockContext(ctx context.Context) (Block, error) {
+	var last_err error
+	for attempts := 0; attempts <= c.Settings.MaxQueryAttempts; attempts++ {
+		if err := ctx.Err(); err != nil {
+			return Block{}, err
+		}
+		// connect to one random node
+		nodes := c.PickNodes(1)
+		if len(nodes) == 0 {
+			return Block{}, fmt.Errorf("no nodes available")
+		}
+		block, err := queryNode(ctx, c, nodes[0], func(ctx context.Context, sd *SocketData) (Block, error) {
+			block, err := sd.GetCandidateBlockContext(ctx)
+			if err != nil {
+				return Block{}, err
+			}
+			if bnum := binary.LittleEndian.Uint64(block.Trailer.Bnum[:]); bnum != sd.block_num+1 {
+				return Block{}, fmt.Errorf("candidate block %d does not follow block %d", bnum, sd.block_num)
+			}
+			return block, nil
+		})
+		if err == nil {
+			return block, nil
+		}
+		last_err = err
+		c.logger().Warn("candidate block download failed", "node", nodes[0].IP, "error", err)
+		// a busy node is not broken, give the network some time
+		if errors.Is(err, ErrNodeBusy) && !sleepContext(ctx, busyBackoff(attempts)) {
+			return Block{}, ctx.Err()
+		}
+	}
+	return Block{}, fmt.Errorf("max query attempts reached: %w", last_err)
 }
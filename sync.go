@@ -0,0 +1,256 @@
+package go_mcminterface
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+// LedgerSnapshot is a local ledger as of block Block. Past the upgrade to the
+// v3 format (Settings.V3Block) the ledger is LedgerV3 and Ledger is nil.
+type LedgerSnapshot struct {
+	Ledger   *Ledger
+	LedgerV3 *LedgerV3
+	Block    uint64
+	Hash     [HASHLEN]byte // hash of Block
+}
+
+// SyncFromSnapshot builds a local ledger without replaying the history: the
+// trailer file is downloaded to tfile_path (completing what it holds) and
+// validated, the ledger is taken from the latest neo-genesis block, checked
+// against its trailer, and the following blocks are applied on top of it.
+// progress, if not nil, is called with each block applied.
+func (c *Client) SyncFromSnapshot(tfile_path string, progress func(block uint64)) (*LedgerSnapshot, error) {
+	return c.SyncFromSnapshotContext(context.Background(), tfile_path, progress)
+}
+
+// SyncFromSnapshotContext is SyncFromSnapshot giving up when ctx is done
+func (c *Client) SyncFromSnapshotContext(ctx context.Context, tfile_path string, progress func(block uint64)) (*LedgerSnapshot, error) {
+	// the trailers link every block to the tip agreed by the network, one
+	// node streams them all
+	if err := c.DownloadTrailerFileContext(ctx, tfile_path, nil); err != nil {
+		return nil, err
+	}
+	file, err := os.Open(tfile_path)
+	if err != nil {
+		return nil, err
+	}
+	trailers, err := ReadTrailers(bufio.NewReader(file))
+	file.Close()
+	if err != nil {
+		return nil, err
+	}
+	if len(trailers) == 0 || binary.LittleEndian.Uint64(trailers[0].Bnum[:]) != 0 {
+		return nil, fmt.Errorf("trailer file does not start at the genesis block")
+	}
+	latest := uint64(len(trailers) - 1)
+	c.logger().Info("trailer chain validated", "blocks", len(trailers))
+
+	// the ledger of the latest neo-genesis block, the genesis block itself on
+	// a chain of less than 256 blocks: it is fetched by number, block 0
+	// meaning the latest block in QueryBlockBytes
+	neogenesis := latest &^ 0xff
+	bytes, err := c.queryBlockMatching(ctx, neogenesis, trailers[neogenesis].Bhash, true)
+	if err != nil {
+		return nil, fmt.Errorf("neo-genesis block %d: %w", neogenesis, err)
+	}
+	if c.IsV3Block(neogenesis) {
+		return c.syncV3(ctx, trailers, neogenesis, bytes, progress)
+	}
+	block, err := ParseBlock(bytes)
+	if err != nil {
+		return nil, err
+	}
+	if block.Type() != BLOCK_NEOGENESIS {
+		return nil, fmt.Errorf("block %d is not a neo-genesis block", neogenesis)
+	}
+	balances := make(map[[TXADDRLEN]byte]uint64, len(block.Ledger))
+	for _, entry := range block.Ledger {
+		balances[entry.Address] = entry.Amount
+	}
+	c.logger().Info("snapshot loaded", "block", neogenesis, "entries", len(block.Ledger))
+
+	// replay the blocks after the snapshot
+	for bnum := neogenesis + 1; bnum <= latest; bnum++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		trailer := trailers[bnum]
+		if isPseudoTrailer(trailer) {
+			continue
+		}
+		block, err := c.QueryBlockFromNumberContext(ctx, bnum)
+		if err != nil {
+			return nil, err
+		}
+		if block.Trailer.Bhash != trailer.Bhash {
+			return nil, fmt.Errorf("block %d does not match its trailer", bnum)
+		}
+		if err := block.ValidateTransactions(); err != nil {
+			return nil, err
+		}
+		if err := applyBlock(balances, &block); err != nil {
+			return nil, err
+		}
+		if progress != nil {
+			progress(bnum)
+		}
+	}
+
+	return &LedgerSnapshot{
+		Ledger: ledgerFromBalances(balances),
+		Block:  latest,
+		Hash:   trailers[latest].Bhash,
+	}, nil
+}
+
+// syncV3 is SyncFromSnapshot from the v3 neo-genesis block neogenesis, whose
+// bytes are checked against its trailer already. Settings.V3Block being a
+// neo-genesis block, every block replayed is in the v3 format.
+func (c *Client) syncV3(ctx context.Context, trailers []BTRAILER, neogenesis uint64, neogenesis_bytes []byte, progress func(block uint64)) (*LedgerSnapshot, error) {
+	latest := uint64(len(trailers) - 1)
+	block, err := BlockV3FromBytes(neogenesis_bytes)
+	if err != nil {
+		return nil, err
+	}
+	if block.Type() != BLOCK_NEOGENESIS {
+		return nil, fmt.Errorf("block %d is not a neo-genesis block", neogenesis)
+	}
+	balances := newBalancesV3(block.Ledger)
+	c.logger().Info("snapshot loaded", "block", neogenesis, "entries", len(block.Ledger), "format", "v3")
+
+	for bnum := neogenesis + 1; bnum <= latest; bnum++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		trailer := trailers[bnum]
+		if isPseudoTrailer(trailer) {
+			continue
+		}
+		block, err := c.QueryBlockV3FromNumberContext(ctx, bnum)
+		if err != nil {
+			return nil, err
+		}
+		if block.Trailer.Bhash != trailer.Bhash {
+			return nil, fmt.Errorf("block %d does not match its trailer", bnum)
+		}
+		if err := block.ValidateTransactions(); err != nil {
+			return nil, err
+		}
+		if err := balances.apply(&block); err != nil {
+			return nil, err
+		}
+		if progress != nil {
+			progress(bnum)
+		}
+	}
+
+	return &LedgerSnapshot{
+		LedgerV3: ledgerV3FromBalances(balances.amounts),
+		Block:    latest,
+		Hash:     trailers[latest].Bhash,
+	}, nil
+}
+
+// balancesV3 are the balances of a v3 ledger being replayed, indexed by tag
+type balancesV3 struct {
+	amounts map[AddressV3]uint64
+	tags    map[[ADDR_TAG_LEN]byte]AddressV3
+}
+
+func newBalancesV3(entries []LedgerEntryV3) *balancesV3 {
+	b := &balancesV3{
+		amounts: make(map[AddressV3]uint64, len(entries)),
+		tags:    make(map[[ADDR_TAG_LEN]byte]AddressV3, len(entries)),
+	}
+	for _, entry := range entries {
+		b.credit(entry.Address, entry.Amount)
+	}
+	return b
+}
+
+func (b *balancesV3) credit(address AddressV3, amount uint64) {
+	b.amounts[address] += amount
+	b.tags[[ADDR_TAG_LEN]byte(address.Tag())] = address
+}
+
+// creditTag credits the address holding tag, or the implicit address of tag
+// if no address holds it
+func (b *balancesV3) creditTag(tag [ADDR_TAG_LEN]byte, amount uint64) {
+	address, found := b.tags[tag]
+	if !found {
+		copy(address[:ADDR_TAG_LEN], tag[:])
+		copy(address[ADDR_TAG_LEN:], tag[:])
+	}
+	b.credit(address, amount)
+}
+
+// apply moves the balances of the transactions of a v3 block, like
+// applyBlock: sources are spent entirely, destinations credited by tag and
+// change credited to the change address
+func (b *balancesV3) apply(block *BlockV3) error {
+	bnum := binary.LittleEndian.Uint64(block.Trailer.Bnum[:])
+	var fees uint64
+	for i := range block.Body {
+		tx := &block.Body[i]
+		send := binary.LittleEndian.Uint64(tx.Send_total[:])
+		change := binary.LittleEndian.Uint64(tx.Change_total[:])
+		fee := binary.LittleEndian.Uint64(tx.Tx_fee[:])
+		balance, found := b.amounts[tx.Src_addr]
+		if !found || balance != send+change+fee {
+			return &ErrBadTransaction{Block: bnum, Index: i, Reason: "amounts do not match the source balance"}
+		}
+		delete(b.amounts, tx.Src_addr)
+		delete(b.tags, [ADDR_TAG_LEN]byte(tx.Src_addr.Tag()))
+		fees += fee
+		for _, dst := range tx.Destinations {
+			b.creditTag(dst.Tag, binary.LittleEndian.Uint64(dst.Amount[:]))
+		}
+		if change > 0 {
+			b.credit(tx.Chg_addr, change)
+		}
+	}
+	if block.Type() == BLOCK_NORMAL {
+		b.credit(block.Header.Maddr, block.Header.Mreward+fees)
+	}
+	return nil
+}
+
+// applyBlock moves the balances of the transactions of block, and credits
+// the miner with the reward and the fees
+func applyBlock(balances map[[TXADDRLEN]byte]uint64, block *Block) error {
+	bnum := binary.LittleEndian.Uint64(block.Trailer.Bnum[:])
+	var fees uint64
+	for i := range block.Body {
+		tx := &block.Body[i]
+		send := binary.LittleEndian.Uint64(tx.Send_total[:])
+		change := binary.LittleEndian.Uint64(tx.Change_total[:])
+		fee := binary.LittleEndian.Uint64(tx.Tx_fee[:])
+		// a source is spent entirely
+		if balances[tx.Src_addr] != send+change+fee {
+			return &ErrBadTransaction{Block: bnum, Index: i, Reason: "amounts do not match the source balance"}
+		}
+		delete(balances, tx.Src_addr)
+		fees += fee
+		balances[tx.Dst_addr] += send
+		if change > 0 {
+			balances[tx.Chg_addr] += change
+		}
+	}
+	if block.Type() == BLOCK_NORMAL {
+		balances[block.Header.Maddr] += block.Header.Mreward + fees
+	}
+	return nil
+}
+
+// SyncFromSnapshot builds a local ledger with DefaultClient
+func SyncFromSnapshot(tfile_path string, progress func(block uint64)) (*LedgerSnapshot, error) {
+	return DefaultClient.SyncFromSnapshot(tfile_path, progress)
+}
+
+// SyncFromSnapshotContext is SyncFromSnapshot giving up when ctx is done
+func SyncFromSnapshotContext(ctx context.Context, tfile_path string, progress func(block uint64)) (*LedgerSnapshot, error) {
+	return DefaultClient.SyncFromSnapshotContext(ctx, tfile_path, progress)
+}
@@ -0,0 +1,177 @@
+package go_mcminterface
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// DownloadTrailerFile downloads the whole trailer file of the network to
+// path with OP_GET_TFILE. If path already holds part of the file, it is kept
+// up to its last complete trailer and only the rest is written; OP_GET_TFILE
+// has no offset, so the node still sends the file from the start and the
+// bytes already held are skipped. progress, if not nil, is called with the
+// size of the file while it grows.
+// Once downloaded, the chain of the file is validated and its last
+// hash is checked against the one agreed by the network.
+func (c *Client) DownloadTrailerFile(path string, progress func(size int64)) error {
+	return c.DownloadTrailerFileContext(context.Background(), path, progress)
+}
+
+// DownloadTrailerFileContext is DownloadTrailerFile giving up when ctx is done
+func (c *Client) DownloadTrailerFileContext(ctx context.Context, path string, progress func(size int64)) error {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var last_err error
+	for attempts := 0; attempts <= c.Settings.MaxQueryAttempts; attempts++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		// resume after the last complete trailer
+		size, err := truncateTrailers(file)
+		if err != nil {
+			return err
+		}
+		nodes := c.PickNodes(1)
+		if len(nodes) == 0 {
+			return fmt.Errorf("no nodes available")
+		}
+		last_err = c.downloadTrailerFile(ctx, nodes[0], file, size, progress)
+		if last_err == nil {
+			break
+		}
+		c.logger().Warn("trailer file download failed", "node", nodes[0].IP, "offset", size, "error", last_err)
+		// a busy node is not broken, give the network some time
+		if errors.Is(last_err, ErrNodeBusy) && !sleepContext(ctx, busyBackoff(attempts)) {
+			return ctx.Err()
+		}
+	}
+	if last_err != nil {
+		return fmt.Errorf("max query attempts reached: %w", last_err)
+	}
+	if _, err := truncateTrailers(file); err != nil {
+		return err
+	}
+
+	// verify the chain of the whole file
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	count, last, err := verifyTrailerStream(bufio.NewReader(file))
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return fmt.Errorf("trailer file is empty")
+	}
+
+	// the tip must be the one agreed by the network
+	bnum := binary.LittleEndian.Uint64(last.Bnum[:])
+	hash, err := c.QueryBlockHashContext(ctx, bnum)
+	if err != nil {
+		return err
+	}
+	if hash != last.Bhash {
+		return fmt.Errorf("hash of block %d does not match the network", bnum)
+	}
+	return nil
+}
+
+// downloadTrailerFile appends the trailer file of node to file, skipping the
+// `offset` bytes file already holds
+func (c *Client) downloadTrailerFile(ctx context.Context, node RemoteNode, file *os.File, offset int64, progress func(size int64)) error {
+	sd, err := c.ConnectToNodeContext(ctx, node.IP)
+	if err != nil {
+		return err
+	}
+	defer sd.Close()
+
+	w := bufio.NewWriter(file)
+	_, err = sd.GetTrailerFileContext(ctx, w, offset, func(written int64) {
+		if progress != nil {
+			progress(offset + written)
+		}
+	})
+	if flush_err := w.Flush(); err == nil {
+		err = flush_err
+	}
+	return err
+}
+
+// truncateTrailers drops a partial trailer at the end of file and moves the
+// file offset to the end, returning the size of the file
+func truncateTrailers(file *os.File) (int64, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	size := info.Size() - info.Size()%BTRAILER_LEN
+	if size != info.Size() {
+		if err := file.Truncate(size); err != nil {
+			return 0, err
+		}
+	}
+	return file.Seek(size, io.SeekStart)
+}
+
+// verifyTrailerStream reads the trailers of r checking that they form a
+// chain, see ValidateTrailerChain. It returns the number of trailers and the
+// last one.
+func verifyTrailerStream(r io.Reader) (uint64, BTRAILER, error) {
+	var count uint64
+	var prev BTRAILER
+	buf := make([]byte, BTRAILER_LEN)
+	for {
+		_, err := io.ReadFull(r, buf)
+		if err == io.EOF {
+			return count, prev, nil
+		}
+		if err != nil {
+			return count, prev, err
+		}
+		trailer := bTrailerFromBytes(buf)
+		var last *BTRAILER
+		if count > 0 {
+			last = &prev
+		}
+		if err := validateTrailer(int(count), last, trailer); err != nil {
+			return count, prev, err
+		}
+		prev = trailer
+		count++
+	}
+}
+
+// ReadTrailers reads all the trailers of a trailer file
+func ReadTrailers(r io.Reader) ([]BTRAILER, error) {
+	var trailers []BTRAILER
+	buf := make([]byte, BTRAILER_LEN)
+	for {
+		_, err := io.ReadFull(r, buf)
+		if err == io.EOF {
+			return trailers, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		trailers = append(trailers, bTrailerFromBytes(buf))
+	}
+}
+
+// DownloadTrailerFile downloads the trailer file with DefaultClient
+func DownloadTrailerFile(path string, progress func(size int64)) error {
+	return DefaultClient.DownloadTrailerFile(path, progress)
+}
+
+// DownloadTrailerFileContext is DownloadTrailerFile giving up when ctx is done
+func DownloadTrailerFileContext(ctx context.Context, path string, progress func(size int64)) error {
+	return DefaultClient.DownloadTrailerFileContext(ctx, path, progress)
+}
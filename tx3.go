@@ -0,0 +1,495 @@
+package go_mcminterface
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"golang.org/x/crypto/ripemd160"
+	"golang.org/x/crypto/sha3"
+)
+
+// Sizes of the v3 format
+const (
+	ADDR_TAG_LEN  = 20
+	ADDR_HASH_LEN = 20
+	ADDR_LEN      = ADDR_TAG_LEN + ADDR_HASH_LEN
+
+	TXHDR_LEN      = 4 + 2*ADDR_LEN + 4*TXAMOUNT // options, addresses, amounts, blocks to live
+	MDST_LEN       = ADDR_TAG_LEN + 16 + TXAMOUNT
+	MDST_MAX       = 256
+	TXWOTS_LEN     = TXSIGLEN + 2*HASHLEN // signature, public seed, address seed
+	TXTLR_LEN      = 8 + HASHLEN          // nonce, tx id
+	BHEADER_V3_LEN = 4 + ADDR_LEN + 8
+	LENTRY_V3_LEN  = ADDR_LEN + TXAMOUNT // v3 ledger entry: an address and its balance
+
+	// largest v3 transaction carried by a TX frame, in place of the v2
+	// addresses, amounts and signature
+	TXV3_FRAME_LEN = SEND_FILE_LEN
+)
+
+// PVERSION3 is the protocol version from which nodes speak the v3 format,
+// as told by the Version of their answer to OP_HELLO
+const PVERSION3 = 5
+
+// AddressHash hashes a WOTS+ public key into a v3 address hash:
+// ripemd160(sha3-256(pk))
+func AddressHash(pk []byte) [ADDR_HASH_LEN]byte {
+	sum := sha3.Sum256(pk)
+	h := ripemd160.New()
+	h.Write(sum[:])
+	var hash [ADDR_HASH_LEN]byte
+	copy(hash[:], h.Sum(nil))
+	return hash
+}
+
+// AddressV3 is a tag followed by the hash of a WOTS+ public key. A new
+// address has an implicit tag, equal to its hash.
+type AddressV3 [ADDR_LEN]byte
+
+// ImplicitAddress returns the v3 address of a WOTS+ address, with its
+// implicit tag
+func ImplicitAddress(address WotsAddress) AddressV3 {
+	var addr AddressV3
+	hash := AddressHash(address.Address[:WOTS_PK_LEN])
+	copy(addr[:ADDR_TAG_LEN], hash[:])
+	copy(addr[ADDR_TAG_LEN:], hash[:])
+	return addr
+}
+
+func (a AddressV3) Tag() []byte {
+	return a[:ADDR_TAG_LEN]
+}
+
+func (a AddressV3) Hash() []byte {
+	return a[ADDR_TAG_LEN:]
+}
+
+// MDST is a destination of a v3 transaction
+type MDST struct {
+	Tag    [ADDR_TAG_LEN]byte
+	Ref    [16]byte // reference, free text
+	Amount [TXAMOUNT]byte
+}
+
+// TransactionV3 is a v3 transaction: header, destinations, WOTS+ signature
+// and trailer. Options[0] is the number of destinations minus one.
+type TransactionV3 struct {
+	Options      [4]byte
+	Src_addr     AddressV3
+	Chg_addr     AddressV3
+	Send_total   [TXAMOUNT]byte
+	Change_total [TXAMOUNT]byte
+	Tx_fee       [TXAMOUNT]byte
+	Blk_to_live  [TXAMOUNT]byte
+	Destinations []MDST
+	Tx_sig       [TXSIGLEN]byte
+	Pub_seed     [HASHLEN]byte
+	Adrs         [HASHLEN]byte
+	Nonce        [8]byte
+	Tx_id        [HASHLEN]byte
+}
+
+// Len returns the size of the serialized transaction
+func (tx *TransactionV3) Len() int {
+	return TXHDR_LEN + len(tx.Destinations)*MDST_LEN + TXWOTS_LEN + TXTLR_LEN
+}
+
+// signedBytes returns the header and the destinations, which are signed
+func (tx *TransactionV3) signedBytes() []byte {
+	bytes := make([]byte, 0, tx.Len())
+	bytes = append(bytes, tx.Options[:]...)
+	bytes = append(bytes, tx.Src_addr[:]...)
+	bytes = append(bytes, tx.Chg_addr[:]...)
+	bytes = append(bytes, tx.Send_total[:]...)
+	bytes = append(bytes, tx.Change_total[:]...)
+	bytes = append(bytes, tx.Tx_fee[:]...)
+	bytes = append(bytes, tx.Blk_to_live[:]...)
+	for _, dst := range tx.Destinations {
+		bytes = append(bytes, dst.Tag[:]...)
+		bytes = append(bytes, dst.Ref[:]...)
+		bytes = append(bytes, dst.Amount[:]...)
+	}
+	return bytes
+}
+
+// SignedMessage returns the message signed by Tx_sig: the sha256 of the
+// header and the destinations
+func (tx *TransactionV3) SignedMessage() [HASHLEN]byte {
+	return sha256.Sum256(tx.signedBytes())
+}
+
+// ComputeID returns the transaction id: the sha256 of everything before it
+func (tx *TransactionV3) ComputeID() [HASHLEN]byte {
+	bytes := tx.Bytes()
+	return sha256.Sum256(bytes[:len(bytes)-HASHLEN])
+}
+
+// Bytes serializes the transaction
+func (tx *TransactionV3) Bytes() []byte {
+	bytes := tx.signedBytes()
+	bytes = append(bytes, tx.Tx_sig[:]...)
+	bytes = append(bytes, tx.Pub_seed[:]...)
+	bytes = append(bytes, tx.Adrs[:]...)
+	bytes = append(bytes, tx.Nonce[:]...)
+	bytes = append(bytes, tx.Tx_id[:]...)
+	return bytes
+}
+
+// TransactionV3FromBytes parses the transaction at the start of bytes,
+// returning it and its size
+func TransactionV3FromBytes(bytes []byte) (TransactionV3, int, error) {
+	var tx TransactionV3
+	if len(bytes) < TXHDR_LEN {
+		return tx, 0, fmt.Errorf("v3 transaction too short: %d bytes", len(bytes))
+	}
+	copy(tx.Options[:], bytes[0:4])
+	copy(tx.Src_addr[:], bytes[4:44])
+	copy(tx.Chg_addr[:], bytes[44:84])
+	copy(tx.Send_total[:], bytes[84:92])
+	copy(tx.Change_total[:], bytes[92:100])
+	copy(tx.Tx_fee[:], bytes[100:108])
+	copy(tx.Blk_to_live[:], bytes[108:116])
+
+	count := int(tx.Options[0]) + 1
+	tx.Destinations = make([]MDST, count)
+	if len(bytes) < tx.Len() {
+		return TransactionV3{}, 0, fmt.Errorf("v3 transaction too short: %d bytes, %d needed", len(bytes), tx.Len())
+	}
+	i := TXHDR_LEN
+	for j := range tx.Destinations {
+		copy(tx.Destinations[j].Tag[:], bytes[i:i+20])
+		copy(tx.Destinations[j].Ref[:], bytes[i+20:i+36])
+		copy(tx.Destinations[j].Amount[:], bytes[i+36:i+44])
+		i += MDST_LEN
+	}
+	copy(tx.Tx_sig[:], bytes[i:i+TXSIGLEN])
+	copy(tx.Pub_seed[:], bytes[i+TXSIGLEN:i+TXSIGLEN+32])
+	copy(tx.Adrs[:], bytes[i+TXSIGLEN+32:i+TXWOTS_LEN])
+	i += TXWOTS_LEN
+	copy(tx.Nonce[:], bytes[i:i+8])
+	copy(tx.Tx_id[:], bytes[i+8:i+TXTLR_LEN])
+	return tx, tx.Len(), nil
+}
+
+// TransactionV3FromTX parses the v3 transaction carried by an OP_TX frame:
+// its bytes start the buffer, Len telling their size
+func TransactionV3FromTX(frame TX) (TransactionV3, error) {
+	size := int(binary.LittleEndian.Uint16(frame.Len[:]))
+	if size > TXV3_FRAME_LEN {
+		return TransactionV3{}, fmt.Errorf("v3 transaction of %d bytes does not fit a TX frame", size)
+	}
+	tx, n, err := TransactionV3FromBytes(frame.GetBytes()[124 : 124+size])
+	if err != nil {
+		return TransactionV3{}, err
+	}
+	if n != size {
+		return TransactionV3{}, fmt.Errorf("TX frame holds %d bytes after the v3 transaction", size-n)
+	}
+	return tx, nil
+}
+
+// Sign fills the destination count, the signature and the transaction id,
+// signing with keypair, whose implicit address must be Src_addr
+func (tx *TransactionV3) Sign(keypair WotsKeypair) error {
+	if len(tx.Destinations) == 0 || len(tx.Destinations) > MDST_MAX {
+		return fmt.Errorf("v3 transaction needs 1 to %d destinations", MDST_MAX)
+	}
+	tx.Options[0] = byte(len(tx.Destinations) - 1)
+
+	var total uint64
+	for _, dst := range tx.Destinations {
+		amount := binary.LittleEndian.Uint64(dst.Amount[:])
+		if total+amount < total {
+			return fmt.Errorf("destination amounts overflow")
+		}
+		total += amount
+	}
+	if total != binary.LittleEndian.Uint64(tx.Send_total[:]) {
+		return fmt.Errorf("destinations add up to %d, not to the send total", total)
+	}
+
+	address := keypair.Address()
+	if hash := AddressHash(address.Address[:WOTS_PK_LEN]); !bytes.Equal(hash[:], tx.Src_addr.Hash()) {
+		return fmt.Errorf("keypair does not own the source address")
+	}
+	msg := tx.SignedMessage()
+	sig, err := keypair.Sign(msg[:])
+	if err != nil {
+		return err
+	}
+	tx.Tx_sig = sig
+	copy(tx.Pub_seed[:], address.Address[WOTS_PUB_SEED:WOTS_ADDR_SEED])
+	copy(tx.Adrs[:], address.Address[WOTS_ADDR_SEED:])
+	tx.Tx_id = tx.ComputeID()
+	return nil
+}
+
+// Verify checks the signature and the transaction id
+func (tx *TransactionV3) Verify() bool {
+	msg := tx.SignedMessage()
+	pk := WotsPkFromSig(tx.Tx_sig[:], msg[:], tx.Pub_seed[:], tx.Adrs[:])
+	if hash := AddressHash(pk); !bytes.Equal(hash[:], tx.Src_addr.Hash()) {
+		return false
+	}
+	return tx.ComputeID() == tx.Tx_id
+}
+
+// ValidateTransactions checks the transactions of a v3 block: signature and
+// Tx_id, ascending Tx_id order, destinations adding up to the send total and
+// a fee covering the Mfee of the trailer. Balances are not checked.
+// The returned *ErrBadTransaction tells which transaction is wrong.
+func (bd *BlockV3) ValidateTransactions() error {
+	bnum := binary.LittleEndian.Uint64(bd.Trailer.Bnum[:])
+	min_fee := binary.LittleEndian.Uint64(bd.Trailer.Mfee[:])
+	for i := range bd.Body {
+		tx := &bd.Body[i]
+		fail := func(format string, args ...any) error {
+			return &ErrBadTransaction{Block: bnum, Index: i, Reason: fmt.Sprintf(format, args...)}
+		}
+
+		if !tx.Verify() {
+			return fail("invalid signature or Tx_id")
+		}
+		if i > 0 && bytes.Compare(tx.Tx_id[:], bd.Body[i-1].Tx_id[:]) <= 0 {
+			return fail("Tx_id not in ascending order")
+		}
+		if int(tx.Options[0])+1 != len(tx.Destinations) {
+			return fail("destination count does not match the options")
+		}
+		var total uint64
+		for _, dst := range tx.Destinations {
+			amount := binary.LittleEndian.Uint64(dst.Amount[:])
+			if total+amount < total {
+				return fail("amounts overflow")
+			}
+			total += amount
+		}
+		send := binary.LittleEndian.Uint64(tx.Send_total[:])
+		change := binary.LittleEndian.Uint64(tx.Change_total[:])
+		fee := binary.LittleEndian.Uint64(tx.Tx_fee[:])
+		if total != send {
+			return fail("destinations add up to %d, not to the send total %d", total, send)
+		}
+		if send+change < send || send+change+fee < fee {
+			return fail("amounts overflow")
+		}
+		if fee < min_fee {
+			return fail("fee %d below the minimum %d", fee, min_fee)
+		}
+		if tx.Src_addr == tx.Chg_addr {
+			return fail("change address is the source address")
+		}
+	}
+	return nil
+}
+
+// LedgerEntryV3 is an entry of a v3 ledger
+type LedgerEntryV3 struct {
+	Address AddressV3
+	Amount  uint64
+}
+
+// LedgerV3 is a ledger of the v3 format, the body of a v3 neo-genesis block:
+// entries sorted by address, hence by tag
+type LedgerV3 struct {
+	entries []LedgerEntryV3
+}
+
+// LedgerV3FromBytes parses v3 ledger entries, which must be sorted by address
+func LedgerV3FromBytes(data []byte) (*LedgerV3, error) {
+	if len(data)%LENTRY_V3_LEN != 0 {
+		return nil, fmt.Errorf("v3 ledger size %d is not a multiple of %d", len(data), LENTRY_V3_LEN)
+	}
+	entries := make([]LedgerEntryV3, len(data)/LENTRY_V3_LEN)
+	for i := range entries {
+		entry := data[i*LENTRY_V3_LEN : (i+1)*LENTRY_V3_LEN]
+		copy(entries[i].Address[:], entry[:ADDR_LEN])
+		entries[i].Amount = binary.LittleEndian.Uint64(entry[ADDR_LEN:])
+		if i > 0 && bytes.Compare(entries[i-1].Address[:], entries[i].Address[:]) >= 0 {
+			return nil, fmt.Errorf("v3 ledger entry %d is out of order", i)
+		}
+	}
+	return &LedgerV3{entries: entries}, nil
+}
+
+// ledgerV3FromBalances builds a v3 ledger from balances by address, dropping
+// the empty ones
+func ledgerV3FromBalances(balances map[AddressV3]uint64) *LedgerV3 {
+	entries := make([]LedgerEntryV3, 0, len(balances))
+	for address, balance := range balances {
+		if balance > 0 {
+			entries = append(entries, LedgerEntryV3{Address: address, Amount: balance})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i].Address[:], entries[j].Address[:]) < 0
+	})
+	return &LedgerV3{entries: entries}
+}
+
+// Len returns the number of entries
+func (l *LedgerV3) Len() int {
+	return len(l.entries)
+}
+
+// Entries returns the entries, sorted by address
+func (l *LedgerV3) Entries() []LedgerEntryV3 {
+	return l.entries
+}
+
+// Bytes serializes the ledger
+func (l *LedgerV3) Bytes() []byte {
+	data := make([]byte, 0, len(l.entries)*LENTRY_V3_LEN)
+	for i := range l.entries {
+		data = append(data, l.entries[i].Address[:]...)
+		data = binary.LittleEndian.AppendUint64(data, l.entries[i].Amount)
+	}
+	return data
+}
+
+// Balance looks up the balance of address
+func (l *LedgerV3) Balance(address AddressV3) (uint64, bool) {
+	i := sort.Search(len(l.entries), func(i int) bool {
+		return bytes.Compare(l.entries[i].Address[:], address[:]) >= 0
+	})
+	if i < len(l.entries) && l.entries[i].Address == address {
+		return l.entries[i].Amount, true
+	}
+	return 0, false
+}
+
+// Resolve looks up the entry holding tag
+func (l *LedgerV3) Resolve(tag []byte) (LedgerEntryV3, bool) {
+	i := sort.Search(len(l.entries), func(i int) bool {
+		return bytes.Compare(l.entries[i].Address.Tag(), tag) >= 0
+	})
+	if i < len(l.entries) && bytes.Equal(l.entries[i].Address.Tag(), tag) {
+		return l.entries[i], true
+	}
+	return LedgerEntryV3{}, false
+}
+
+// BHEADERV3 is the header of a v3 block, whose miner address is hashed
+type BHEADERV3 struct {
+	Hdrlen  uint32
+	Maddr   AddressV3
+	Mreward uint64
+}
+
+// BlockV3 is a block of the v3 format. Like Block, it is a normal block,
+// a pseudo-block or a neo-genesis block holding a v3 ledger.
+type BlockV3 struct {
+	Header  BHEADERV3
+	Body    []TransactionV3
+	Ledger  []LedgerEntryV3 // neo-genesis blocks only, sorted by address
+	Trailer BTRAILER
+}
+
+// IsBlockV3 tells if the block bytes are a normal block of the v3 format,
+// from their header length. Pseudo-blocks look the same in both formats and
+// neo-genesis blocks are told apart by their height only, see
+// Client.IsV3Block.
+func IsBlockV3(bytes []byte) bool {
+	return len(bytes) >= 4 && binary.LittleEndian.Uint32(bytes[0:4]) == BHEADER_V3_LEN &&
+		BlockTypeV3(bytes) == BLOCK_NORMAL
+}
+
+// BlockTypeV3 tells the kind of a block of the v3 format, like BlockType: a
+// header length of BHEADER_V3_LEN is a normal block, 4 with nothing else but
+// the trailer a pseudo-block, and 4 plus whole v3 ledger entries on a
+// multiple of 256 a neo-genesis block. The transactions of a normal block
+// are checked by BlockV3FromBytes.
+func BlockTypeV3(bytes []byte) int {
+	if len(bytes) < 4+BTRAILER_LEN {
+		return BLOCK_INVALID
+	}
+	hdrlen := binary.LittleEndian.Uint32(bytes[0:4])
+	if uint64(hdrlen) > uint64(len(bytes)-BTRAILER_LEN) {
+		return BLOCK_INVALID
+	}
+	bnum := binary.LittleEndian.Uint64(bytes[len(bytes)-BTRAILER_LEN+32:])
+	// a ledger of a single entry has the header length of a normal block
+	switch {
+	case bnum&0xff == 0:
+		if hdrlen >= 4 && (hdrlen-4)%LENTRY_V3_LEN == 0 && int(hdrlen)+BTRAILER_LEN == len(bytes) {
+			return BLOCK_NEOGENESIS
+		}
+	case hdrlen == BHEADER_V3_LEN && len(bytes) > BHEADER_V3_LEN+BTRAILER_LEN:
+		return BLOCK_NORMAL
+	case hdrlen == 4 && len(bytes) == 4+BTRAILER_LEN:
+		return BLOCK_PSEUDO
+	}
+	return BLOCK_INVALID
+}
+
+// BlockV3FromBytes parses a v3 block of any kind, failing on malformed bytes
+func BlockV3FromBytes(bytes []byte) (BlockV3, error) {
+	var block BlockV3
+	kind := BlockTypeV3(bytes)
+	if kind == BLOCK_INVALID {
+		return block, fmt.Errorf("malformed v3 block of %d bytes", len(bytes))
+	}
+	block.Header.Hdrlen = binary.LittleEndian.Uint32(bytes[0:4])
+	block.Trailer = bTrailerFromBytes(bytes[len(bytes)-BTRAILER_LEN:])
+
+	switch kind {
+	case BLOCK_NEOGENESIS:
+		ledger, err := LedgerV3FromBytes(bytes[4:block.Header.Hdrlen])
+		if err != nil {
+			return BlockV3{}, err
+		}
+		block.Ledger = ledger.Entries()
+	case BLOCK_NORMAL:
+		copy(block.Header.Maddr[:], bytes[4:4+ADDR_LEN])
+		block.Header.Mreward = binary.LittleEndian.Uint64(bytes[4+ADDR_LEN : BHEADER_V3_LEN])
+		body := bytes[BHEADER_V3_LEN : len(bytes)-BTRAILER_LEN]
+		for len(body) > 0 {
+			tx, n, err := TransactionV3FromBytes(body)
+			if err != nil {
+				return BlockV3{}, fmt.Errorf("transaction %d: %w", len(block.Body), err)
+			}
+			block.Body = append(block.Body, tx)
+			body = body[n:]
+		}
+	}
+	if tcount := binary.LittleEndian.Uint32(block.Trailer.Tcount[:]); int(tcount) != len(block.Body) {
+		return BlockV3{}, fmt.Errorf("trailer counts %d transactions, body has %d", tcount, len(block.Body))
+	}
+	return block, nil
+}
+
+// Type tells the kind of block
+func (bd *BlockV3) Type() int {
+	switch {
+	case binary.LittleEndian.Uint64(bd.Trailer.Bnum[:])&0xff == 0:
+		return BLOCK_NEOGENESIS
+	case bd.Header.Hdrlen == BHEADER_V3_LEN:
+		return BLOCK_NORMAL
+	case bd.Header.Hdrlen == 4:
+		return BLOCK_PSEUDO
+	}
+	return BLOCK_INVALID
+}
+
+// GetBytes serializes the v3 block
+func (bd *BlockV3) GetBytes() []byte {
+	bytes := make([]byte, 4, BHEADER_V3_LEN)
+	binary.LittleEndian.PutUint32(bytes, bd.Header.Hdrlen)
+	// pseudo-blocks and neo-genesis blocks have a header length only
+	if bd.Type() == BLOCK_NORMAL {
+		bytes = append(bytes, bd.Header.Maddr[:]...)
+		bytes = binary.LittleEndian.AppendUint64(bytes, bd.Header.Mreward)
+	}
+	for i := range bd.Body {
+		bytes = append(bytes, bd.Body[i].Bytes()...)
+	}
+	// the ledger of a neo-genesis block is its header
+	for i := range bd.Ledger {
+		bytes = append(bytes, bd.Ledger[i].Address[:]...)
+		bytes = binary.LittleEndian.AppendUint64(bytes, bd.Ledger[i].Amount)
+	}
+	return append(bytes, bd.Trailer.GetBytes()...)
+}
@@ -0,0 +1,280 @@
+package go_mcminterface_test
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	mcm "github.com/NickP005/go_mcminterface"
+	"github.com/NickP005/go_mcminterface/mcmtest"
+)
+
+func TestQueryBlockV3(t *testing.T) {
+	chain := mcmtest.NewChain()
+	genesis, _ := chain.BlockBytes(0)
+
+	keypair := mcm.NewWotsKeypair([]byte("v3 source"))
+	tx := mcm.TransactionV3{
+		Src_addr:     mcm.ImplicitAddress(keypair.Address()),
+		Chg_addr:     mcm.ImplicitAddress(mcm.NewWotsKeypair([]byte("v3 change")).Address()),
+		Destinations: []mcm.MDST{{Tag: [mcm.ADDR_TAG_LEN]byte{1}}},
+	}
+	binary.LittleEndian.PutUint64(tx.Destinations[0].Amount[:], 1000)
+	binary.LittleEndian.PutUint64(tx.Send_total[:], 1000)
+	if err := tx.Sign(keypair); err != nil {
+		t.Fatal(err)
+	}
+
+	block := mcm.BlockV3{
+		Header: mcm.BHEADERV3{Hdrlen: mcm.BHEADER_V3_LEN},
+		Body:   []mcm.TransactionV3{tx},
+	}
+	copy(block.Trailer.Phash[:], genesis[len(genesis)-mcm.HASHLEN:])
+	binary.LittleEndian.PutUint64(block.Trailer.Bnum[:], 1)
+	binary.LittleEndian.PutUint32(block.Trailer.Tcount[:], 1)
+	bytes := block.GetBytes()
+	bhash := sha256.Sum256(bytes[:len(bytes)-mcm.HASHLEN])
+	copy(bytes[len(bytes)-mcm.HASHLEN:], bhash[:])
+	chain.AddBlockBytes(bytes)
+
+	client := mcmtest.NewTestNetwork(t, chain, chain, chain).Client(3)
+
+	got, err := client.QueryBlockV3FromNumber(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Body) != 1 || !got.Body[0].Verify() {
+		t.Errorf("v3 block body does not hold the signed transaction")
+	}
+	if _, err := client.QueryBlockFromNumber(1); err == nil || !strings.Contains(err.Error(), "v3 format") {
+		t.Errorf("QueryBlockFromNumber on a v3 block: err = %v", err)
+	}
+}
+
+// v3Transaction signs a v3 transaction spending balance from the implicit
+// address of src, amount going to dst and the change, less MFEE, to the
+// implicit address of src+" change"
+func v3Transaction(t *testing.T, src string, balance uint64, dst [mcm.ADDR_TAG_LEN]byte, amount uint64) mcm.TransactionV3 {
+	keypair := mcm.NewWotsKeypair([]byte(src))
+	tx := mcm.TransactionV3{
+		Src_addr:     mcm.ImplicitAddress(keypair.Address()),
+		Chg_addr:     mcm.ImplicitAddress(mcm.NewWotsKeypair([]byte(src + " change")).Address()),
+		Destinations: []mcm.MDST{{Tag: dst}},
+	}
+	binary.LittleEndian.PutUint64(tx.Destinations[0].Amount[:], amount)
+	binary.LittleEndian.PutUint64(tx.Send_total[:], amount)
+	binary.LittleEndian.PutUint64(tx.Change_total[:], balance-amount-mcm.MFEE)
+	binary.LittleEndian.PutUint64(tx.Tx_fee[:], mcm.MFEE)
+	if err := tx.Sign(keypair); err != nil {
+		t.Fatal(err)
+	}
+	return tx
+}
+
+func TestBlockTypeV3(t *testing.T) {
+	source := v3Transaction(t, "v3 source", 10000, [mcm.ADDR_TAG_LEN]byte{1}, 1000)
+	chain := mcmtest.NewChain()
+	chain.SetBalanceV3(source.Src_addr, 10000)
+	chain.AddNeoGenesisV3()
+	chain.AddBlockV3([]mcm.TransactionV3{source})
+	chain.AddPseudoBlock()
+	chain.SetBalanceV3(mcm.AddressV3{}, 1)
+	for chain.Height() < 511 {
+		chain.AddPseudoBlock()
+	}
+	// a single entry ledger has the header length of a normal block
+	single := mcmtest.NewChain()
+	single.SetBalanceV3(source.Src_addr, 10000)
+	single.AddNeoGenesisV3()
+
+	block := func(c *mcmtest.Chain, bnum uint64) []byte {
+		bytes, _ := c.BlockBytes(bnum)
+		return bytes
+	}
+	normal := block(chain, 257)
+	wrong_hdrlen := append([]byte{}, normal...)
+	binary.LittleEndian.PutUint32(wrong_hdrlen, mcm.BHEADER_V3_LEN+4)
+	truncated_tx := append(append([]byte{}, normal[:len(normal)-mcm.BTRAILER_LEN-1]...), normal[len(normal)-mcm.BTRAILER_LEN:]...)
+
+	tests := []struct {
+		name    string
+		bytes   []byte
+		kind    int
+		entries int
+	}{
+		{"neo-genesis", block(chain, 256), mcm.BLOCK_NEOGENESIS, 1},
+		{"single entry neo-genesis", block(single, 256), mcm.BLOCK_NEOGENESIS, 1},
+		{"normal", normal, mcm.BLOCK_NORMAL, 0},
+		{"pseudo", block(chain, 258), mcm.BLOCK_PSEUDO, 0},
+		{"v2 normal", block(v2Chain(t), 1), mcm.BLOCK_INVALID, 0},
+		{"truncated", normal[:mcm.BTRAILER_LEN+3], mcm.BLOCK_INVALID, 0},
+		{"wrong header length", wrong_hdrlen, mcm.BLOCK_INVALID, 0},
+		{"truncated transaction", truncated_tx, mcm.BLOCK_NORMAL, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if kind := mcm.BlockTypeV3(tt.bytes); kind != tt.kind {
+				t.Fatalf("BlockTypeV3 = %d, want %d", kind, tt.kind)
+			}
+			parsed, err := mcm.BlockV3FromBytes(tt.bytes)
+			if tt.kind == mcm.BLOCK_INVALID || tt.name == "truncated transaction" {
+				if err == nil {
+					t.Fatal("malformed block parsed")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if parsed.Type() != tt.kind || len(parsed.Ledger) != tt.entries {
+				t.Errorf("parsed kind %d with %d ledger entries", parsed.Type(), len(parsed.Ledger))
+			}
+			if got := parsed.GetBytes(); string(got) != string(tt.bytes) {
+				t.Error("GetBytes does not give back the block bytes")
+			}
+		})
+	}
+}
+
+// v2Chain returns a chain holding a normal v2 block 1
+func v2Chain(t *testing.T) *mcmtest.Chain {
+	chain := mcmtest.NewChain()
+	tx, err := (&mcm.TransactionBuilder{
+		Source:      mcm.NewWotsKeypair([]byte("v2 source")),
+		Balance:     10000,
+		Destination: mcm.NewWotsKeypair([]byte("v2 destination")).Address(),
+		Change:      mcm.NewWotsKeypair([]byte("v2 change")).Address(),
+		Amount:      1000,
+	}).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mine(chain, tx)
+	return chain
+}
+
+func TestSubmitTransactionV3(t *testing.T) {
+	tx := v3Transaction(t, "v3 source", 10000, [mcm.ADDR_TAG_LEN]byte{1}, 1000)
+
+	chain := mcmtest.NewChain()
+	network := mcmtest.NewTestNetwork(t, chain, chain, chain)
+	for i := 1; i <= 3; i++ {
+		network.Node(fmt.Sprintf("10.0.0.%d", i)).SetVersion(mcm.PVERSION3, 0)
+	}
+	client := network.Client(3)
+	if err := client.SubmitTransactionV3(tx); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 3; i++ {
+		// closing waits for the connections to be handled
+		node := network.Node(fmt.Sprintf("10.0.0.%d", i))
+		node.Close()
+		received := node.Received()
+		if len(received) != 1 {
+			t.Fatalf("node %d received %d transactions", i, len(received))
+		}
+		if received[0].GetVersion() != mcm.PVERSION3 {
+			t.Errorf("frame version = %d", received[0].GetVersion())
+		}
+		got, err := mcm.TransactionV3FromTX(received[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Tx_id != tx.Tx_id || !got.Verify() {
+			t.Error("node did not receive the signed transaction")
+		}
+	}
+
+	// v3 nodes do not take v2 transactions
+	v3 := mcmtest.NewTestNetwork(t, chain)
+	v3.Node("10.0.0.1").SetVersion(mcm.PVERSION3, 0)
+	if err := v3.Client(1).SubmitTransaction(mcm.Transaction{}); err == nil {
+		t.Error("v2 transaction submitted to a v3 node")
+	}
+
+	// more destinations than a frame carries
+	keypair := mcm.NewWotsKeypair([]byte("v3 source"))
+	large := tx
+	large.Destinations = make([]mcm.MDST, mcm.MDST_MAX)
+	binary.LittleEndian.PutUint64(large.Destinations[0].Amount[:], 1000)
+	if err := large.Sign(keypair); err != nil {
+		t.Fatal(err)
+	}
+	if err := v3.Client(1).SubmitTransactionV3(large); err == nil {
+		t.Error("v3 transaction larger than a frame submitted")
+	}
+	v3.Node("10.0.0.1").Close()
+	if len(v3.Node("10.0.0.1").Received()) != 0 {
+		t.Error("v3 node received a rejected transaction")
+	}
+
+	// v2 nodes do not take v3 transactions
+	v2 := mcmtest.NewTestNetwork(t, chain)
+	if err := v2.Client(1).SubmitTransactionV3(tx); err == nil {
+		t.Error("v3 transaction submitted to a v2 node")
+	}
+	v2.Node("10.0.0.1").Close()
+	if len(v2.Node("10.0.0.1").Received()) != 0 {
+		t.Error("v2 node received a v3 frame")
+	}
+}
+
+func TestSyncFromSnapshotV3(t *testing.T) {
+	destination := [mcm.ADDR_TAG_LEN]byte{1, 2, 3}
+	tx := v3Transaction(t, "v3 source", 10000, destination, 1000)
+
+	chain := mcmtest.NewChain()
+	chain.SetBalanceV3(tx.Src_addr, 10000)
+	chain.AddNeoGenesisV3()
+	chain.AddBlockV3([]mcm.TransactionV3{tx})
+	chain.AddPseudoBlock()
+	client := mcmtest.NewTestNetwork(t, chain, chain, chain).Client(3)
+
+	// block 256 is a v3 neo-genesis block only for a client told so
+	if _, err := client.SyncFromSnapshot(filepath.Join(t.TempDir(), "tfile.dat"), nil); err == nil {
+		t.Error("v3 neo-genesis block read as a v2 one")
+	}
+	client.Settings.V3Block = 256
+	if !client.IsV3Block(257) || client.IsV3Block(255) {
+		t.Error("IsV3Block does not follow Settings.V3Block")
+	}
+
+	snapshot, err := client.SyncFromSnapshot(filepath.Join(t.TempDir(), "tfile.dat"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.Ledger != nil || snapshot.LedgerV3 == nil || snapshot.Block != 258 {
+		t.Fatalf("snapshot of block %d, v2 ledger %v", snapshot.Block, snapshot.Ledger != nil)
+	}
+	ledger := snapshot.LedgerV3
+	if _, found := ledger.Balance(tx.Src_addr); found {
+		t.Error("source still in the ledger")
+	}
+	if entry, found := ledger.Resolve(destination[:]); !found || entry.Amount != 1000 {
+		t.Errorf("destination balance = %d, found %v", entry.Amount, found)
+	}
+	if balance, _ := ledger.Balance(tx.Chg_addr); balance != 8500 {
+		t.Errorf("change balance = %d", balance)
+	}
+	for _, entry := range ledger.Entries() {
+		if balance, found := chain.BalanceV3(entry.Address); entry.Address != (mcm.AddressV3{}) && (!found || balance != entry.Amount) {
+			t.Errorf("ledger entry %x differs from the chain", entry.Address)
+		}
+	}
+
+	// the block queries pick the format from the height
+	if _, err := client.QueryBlockFromNumber(257); err == nil || !strings.Contains(err.Error(), "v3 format") {
+		t.Errorf("QueryBlockFromNumber on a v3 block: err = %v", err)
+	}
+	pseudo, err := client.QueryBlockV3FromNumber(258)
+	if err != nil || pseudo.Type() != mcm.BLOCK_PSEUDO {
+		t.Errorf("v3 pseudo-block: kind %d, err %v", pseudo.Type(), err)
+	}
+	neogenesis, err := client.QueryBlockV3FromNumber(256)
+	if err != nil || len(neogenesis.Ledger) != 1 {
+		t.Errorf("v3 neo-genesis block: %d entries, err %v", len(neogenesis.Ledger), err)
+	}
+}
@@ -0,0 +1,176 @@
+package go_mcminterface
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+)
+
+// MerkleHeaderHeight is the first block whose Merkle root hashes the block
+// header before the transactions (v2.3), earlier blocks hash the
+// transactions only
+var MerkleHeaderHeight uint64 = 54321
+
+// MerkleRoot computes the Merkle root of the block body, as stored in
+// Trailer.Mroot: the sha256 of the TXQENTRY of the body, in order, preceded
+// by the header from MerkleHeaderHeight.
+func (bd *Block) MerkleRoot() [HASHLEN]byte {
+	mroot := sha256.New()
+	if binary.LittleEndian.Uint64(bd.Trailer.Bnum[:]) >= MerkleHeaderHeight {
+		mroot.Write(bd.Header.GetBytes())
+	}
+	for _, tx := range bd.Body {
+		mroot.Write(tx.GetBytes())
+	}
+	var hash [HASHLEN]byte
+	copy(hash[:], mroot.Sum(nil))
+	return hash
+}
+
+// Verify checks the body of the block against its trailer: Tcount must be
+// the number of transactions, Mroot their Merkle root and Bhash the hash of
+// the whole block. Pseudo-blocks have neither body nor Merkle root.
+// Neo-genesis blocks are hashed with their ledger, ErrNeoGenesis is returned
+// if it is missing.
+func (bd *Block) Verify() error {
+	bnum := binary.LittleEndian.Uint64(bd.Trailer.Bnum[:])
+	if bd.Type() == BLOCK_NEOGENESIS && int(bd.Header.Hdrlen) != 4+len(bd.Ledger)*LENTRY_LEN {
+		return fmt.Errorf("block %d: %w", bnum, ErrNeoGenesis)
+	}
+	if tcount := binary.LittleEndian.Uint32(bd.Trailer.Tcount[:]); int(tcount) != len(bd.Body) {
+		return fmt.Errorf("block %d: trailer counts %d transactions, body has %d", bnum, tcount, len(bd.Body))
+	}
+	if bd.Type() != BLOCK_NORMAL && len(bd.Body) > 0 {
+		return fmt.Errorf("block %d: pseudo-block with a body", bnum)
+	}
+	// a block without transactions is a pseudo-block, see isPseudoTrailer
+	if bd.Type() == BLOCK_NORMAL && len(bd.Body) == 0 {
+		return fmt.Errorf("block %d: normal block without transactions", bnum)
+	}
+	if bd.Type() == BLOCK_NORMAL && bd.MerkleRoot() != bd.Trailer.Mroot {
+		return fmt.Errorf("block %d: Merkle root does not match the body", bnum)
+	}
+	bytes := bd.GetBytes()
+	if sha256.Sum256(bytes[:len(bytes)-HASHLEN]) != bd.Trailer.Bhash {
+		return fmt.Errorf("block %d: block hash does not match", bnum)
+	}
+	return nil
+}
+
+// ValidateTrailerChain checks that trailers form a chain: each Bnum follows
+// the previous one and each Phash is the previous Bhash. The Bhash of
+// pseudo-blocks, made of their trailer only, is recomputed; other blocks
+// need their body to be hashed, see Block.Verify.
+// The returned *ErrTrailerChain tells which trailer is wrong.
+func ValidateTrailerChain(trailers []BTRAILER) error {
+	for i := range trailers {
+		var prev *BTRAILER
+		if i > 0 {
+			prev = &trailers[i-1]
+		}
+		if err := validateTrailer(i, prev, trailers[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateTrailer checks the trailer at position index of a chain against
+// the previous one, nil for the first trailer
+func validateTrailer(index int, prev *BTRAILER, trailer BTRAILER) error {
+	bnum := binary.LittleEndian.Uint64(trailer.Bnum[:])
+	fail := func(format string, args ...any) error {
+		return &ErrTrailerChain{Index: index, Block: bnum, Reason: fmt.Sprintf(format, args...)}
+	}
+
+	if trailer.Bhash == [HASHLEN]byte{} {
+		return fail("empty block hash")
+	}
+	if isPseudoTrailer(trailer) && pseudoBlockHash(trailer) != trailer.Bhash {
+		return fail("block hash of pseudo-block does not match")
+	}
+	if prev == nil {
+		return nil
+	}
+	prev_bnum := binary.LittleEndian.Uint64(prev.Bnum[:])
+	if bnum != prev_bnum+1 {
+		return fail("block number does not follow %d", prev_bnum)
+	}
+	if trailer.Phash != prev.Bhash {
+		return fail("previous hash does not match the hash of block %d", prev_bnum)
+	}
+	return nil
+}
+
+// isPseudoTrailer tells if trailer belongs to a pseudo-block: no
+// transactions and not a (neo-)genesis block. Mined blocks always hold
+// transactions, Block.Verify rejects those without.
+func isPseudoTrailer(trailer BTRAILER) bool {
+	bnum := binary.LittleEndian.Uint64(trailer.Bnum[:])
+	return bnum&0xff != 0 && binary.LittleEndian.Uint32(trailer.Tcount[:]) == 0
+}
+
+// pseudoBlockHash computes the hash of a pseudo-block, which is its 4 bytes
+// header length followed by the trailer
+func pseudoBlockHash(trailer BTRAILER) [HASHLEN]byte {
+	bytes := make([]byte, 4, 4+BTRAILER_LEN)
+	binary.LittleEndian.PutUint32(bytes, 4)
+	bytes = append(bytes, trailer.GetBytes()...)
+	return sha256.Sum256(bytes[:len(bytes)-HASHLEN])
+}
+
+// SignedMessage returns the message signed by Tx_sig, see
+// Transaction.SignedMessage
+func (tx *TXQENTRY) SignedMessage() [HASHLEN]byte {
+	transaction := tx.Transaction()
+	return transaction.SignedMessage()
+}
+
+// ValidateTransactions checks every transaction of the block on its own:
+// the WOTS+ signature, Tx_id (the sha256 of Src_addr), the amounts adding up
+// without overflow, the fee not below the block Mfee, and the change going to
+// another address. Transactions are sorted by ascending Tx_id, as nodes
+// enforce, so a source address can spend once per block.
+// Balances need the ledger and are not checked.
+func (bd *Block) ValidateTransactions() error {
+	bnum := binary.LittleEndian.Uint64(bd.Trailer.Bnum[:])
+	min_fee := binary.LittleEndian.Uint64(bd.Trailer.Mfee[:])
+	for i := range bd.Body {
+		tx := &bd.Body[i]
+		fail := func(format string, args ...any) error {
+			return &ErrBadTransaction{Block: bnum, Index: i, Reason: fmt.Sprintf(format, args...)}
+		}
+
+		if sha256.Sum256(tx.Src_addr[:]) != tx.Tx_id {
+			return fail("Tx_id is not the hash of the source address")
+		}
+		if i > 0 {
+			switch bytes.Compare(tx.Tx_id[:], bd.Body[i-1].Tx_id[:]) {
+			case 0:
+				return fail("source address already spent by transaction %d", i-1)
+			case -1:
+				return fail("Tx_id not in ascending order")
+			}
+		}
+
+		send := binary.LittleEndian.Uint64(tx.Send_total[:])
+		change := binary.LittleEndian.Uint64(tx.Change_total[:])
+		fee := binary.LittleEndian.Uint64(tx.Tx_fee[:])
+		if send+change < send || send+change+fee < fee {
+			return fail("amounts overflow")
+		}
+		if fee < min_fee {
+			return fail("fee %d below the minimum %d", fee, min_fee)
+		}
+		if tx.Src_addr == tx.Chg_addr {
+			return fail("change address is the source address")
+		}
+
+		msg := tx.SignedMessage()
+		if !WotsVerify(WotsAddressFromBytes(tx.Src_addr[:]), msg[:], tx.Tx_sig[:]) {
+			return fail("invalid signature")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package go_mcminterface
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// Wallet derives one-time WOTS+ keypairs from a master seed. The funds live
+// at the address of key Index; each spend signs with it and sends the change
+// to the next key, carrying the tag along.
+// The wallet can be saved as JSON, the master seed being secret.
+type Wallet struct {
+	MasterSeed []byte
+	Tag        []byte          // tag of the wallet, nil if untagged
+	TagOnChain bool            // the tag is in the ledger already, else the next spend creates it
+	Index      uint64          // key holding the funds
+	Signed     map[uint64]bool // keys that already signed, never to be used again
+
+	Client *Client `json:"-"` // used for the queries, DefaultClient if nil
+}
+
+// NewWallet creates a wallet on a master seed, starting at key 0
+func NewWallet(master_seed []byte, tag []byte) *Wallet {
+	return &Wallet{
+		MasterSeed: append([]byte{}, master_seed...),
+		Tag:        tag,
+		Signed:     make(map[uint64]bool),
+	}
+}
+
+func (w *Wallet) client() *Client {
+	if w.Client == nil {
+		return DefaultClient
+	}
+	return w.Client
+}
+
+// Keypair derives the keypair number index: its secret is the sha256 of the
+// master seed followed by index as 8 bytes little endian
+func (w *Wallet) Keypair(index uint64) WotsKeypair {
+	secret := sha256.New()
+	secret.Write(w.MasterSeed)
+	binary.Write(secret, binary.LittleEndian, index)
+	return NewWotsKeypair(secret.Sum(nil))
+}
+
+// Address returns the address of key index, with the wallet tag if any
+func (w *Wallet) Address(index uint64) WotsAddress {
+	address := w.Keypair(index).Address()
+	if w.Tag != nil {
+		address.SetTAG(w.Tag)
+	}
+	return address
+}
+
+// Current returns the address holding the funds, which has the default tag
+// until the wallet tag is created
+func (w *Wallet) Current() WotsAddress {
+	if !w.TagOnChain {
+		return w.Keypair(w.Index).Address()
+	}
+	return w.Address(w.Index)
+}
+
+// Send builds a signed transaction sending amount to destination, the change
+// going to the next key. The current key is marked as signed even if the
+// transaction is never submitted, as it must not sign again.
+func (w *Wallet) Send(destination WotsAddress, amount uint64, fee uint64) (Transaction, error) {
+	return w.SendContext(context.Background(), destination, amount, fee)
+}
+
+// SendContext is Send giving up the queries when ctx is done
+func (w *Wallet) SendContext(ctx context.Context, destination WotsAddress, amount uint64, fee uint64) (Transaction, error) {
+	if w.Signed[w.Index] {
+		return Transaction{}, fmt.Errorf("key %d already signed", w.Index)
+	}
+	// the first spend of a tagged wallet creates the tag on the change
+	var source_tag []byte
+	if w.TagOnChain {
+		source_tag = w.Tag
+	}
+	builder := TransactionBuilder{
+		Source:      w.Keypair(w.Index),
+		SourceTag:   source_tag,
+		Destination: destination,
+		Change:      w.Address(w.Index + 1),
+		Amount:      amount,
+		Fee:         fee,
+		Client:      w.client(),
+	}
+	tx, err := builder.BuildContext(ctx)
+	if err != nil {
+		return Transaction{}, err
+	}
+	if w.Signed == nil {
+		w.Signed = make(map[uint64]bool)
+	}
+	w.Signed[w.Index] = true
+	w.Index++
+	w.TagOnChain = w.Tag != nil
+	return tx, nil
+}
+
+// Scan rebuilds the state of the wallet from the chain, looking at most gap
+// keys past the current one. A wallet whose tag is in the ledger resolves it
+// and looks for the key owning it; otherwise the last key holding a balance
+// is taken.
+// Keys before the one found are marked as signed.
+func (w *Wallet) Scan(gap uint64) error {
+	return w.ScanContext(context.Background(), gap)
+}
+
+// ScanContext is Scan giving up when ctx is done
+func (w *Wallet) ScanContext(ctx context.Context, gap uint64) error {
+	c := w.client()
+	found := false
+	var index uint64
+	if w.Tag != nil {
+		address, err := c.QueryTagResolveContext(ctx, w.Tag)
+		if err != nil && !errors.Is(err, ErrTagNotFound) {
+			return err
+		}
+		w.TagOnChain = err == nil
+		for i := uint64(0); w.TagOnChain && i <= w.Index+gap; i++ {
+			pk := w.Keypair(i).Address()
+			if bytes.Equal(pk.Address[:WOTS_PK_LEN], address.Address[:WOTS_PK_LEN]) {
+				index, found = i, true
+				break
+			}
+		}
+	}
+	// untagged funds are at the last key holding a balance
+	for i := w.Index; !w.TagOnChain && i <= w.Index+gap; i++ {
+		address := w.Keypair(i).Address()
+		balance, err := c.QueryBalanceContext(ctx, hex.EncodeToString(address.Address[:]))
+		if errors.Is(err, ErrAddressNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if balance > 0 {
+			index, found = i, true
+		}
+	}
+	if !found {
+		return fmt.Errorf("no funded key up to key %d", w.Index+gap)
+	}
+
+	if w.Signed == nil {
+		w.Signed = make(map[uint64]bool)
+	}
+	for i := uint64(0); i < index; i++ {
+		w.Signed[i] = true
+	}
+	w.Index = index
+	return nil
+}
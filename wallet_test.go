@@ -0,0 +1,118 @@
+package go_mcminterface_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+
+	mcm "github.com/NickP005/go_mcminterface"
+	"github.com/NickP005/go_mcminterface/mcmtest"
+)
+
+// mine adds a block holding tx to chain
+func mine(chain *mcmtest.Chain, tx mcm.Transaction) {
+	entry := mcm.TXQENTRY{
+		Src_addr:     tx.Src_addr,
+		Dst_addr:     tx.Dst_addr,
+		Chg_addr:     tx.Chg_addr,
+		Send_total:   tx.Send_total,
+		Change_total: tx.Change_total,
+		Tx_fee:       tx.Tx_fee,
+		Tx_sig:       tx.Tx_sig,
+	}
+	entry.Tx_id = sha256.Sum256(entry.Src_addr[:])
+	chain.AddBlock([]mcm.TXQENTRY{entry})
+}
+
+func TestWalletSend(t *testing.T) {
+	chain := mcmtest.NewChain()
+	client := mcmtest.NewTestNetwork(t, chain, chain, chain).Client(3)
+	tag := []byte("wallet tag..")
+	wallet := mcm.NewWallet([]byte("master seed"), tag)
+	wallet.Client = client
+	chain.SetBalance(wallet.Current(), 10000)
+	destination := mcm.NewWotsKeypair([]byte("destination")).Address()
+
+	// the first spend creates the tag on the change
+	tx, err := wallet.Send(destination, 1000, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wallet.Index != 1 || !wallet.Signed[0] || !wallet.TagOnChain {
+		t.Errorf("after the first spend: index %d, signed %v, tag on chain %v", wallet.Index, wallet.Signed, wallet.TagOnChain)
+	}
+	if tx.Chg_addr != wallet.Address(1).Address {
+		t.Error("change does not go to the tagged key 1")
+	}
+	mine(chain, tx)
+
+	// the second spend moves the tag from key 1 to key 2
+	tx, err = wallet.Send(destination, 1000, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wallet.Index != 2 || !wallet.Signed[1] {
+		t.Errorf("after the second spend: index %d, signed %v", wallet.Index, wallet.Signed)
+	}
+	source := mcm.WotsAddressFromBytes(tx.Src_addr[:])
+	if !bytes.Equal(source.GetTAG(), tag) {
+		t.Error("second spend does not use the tagged source")
+	}
+	mine(chain, tx)
+	owner, found := chain.Resolve(tag)
+	if !found || owner.Address != wallet.Address(2).Address {
+		t.Error("tag is not on key 2")
+	}
+	if owner.Amount != 10000-2*1000-2*mcm.MFEE {
+		t.Errorf("tagged balance = %d", owner.Amount)
+	}
+
+	// a key never signs twice
+	wallet.Index = 1
+	if _, err := wallet.Send(destination, 1000, 0); err == nil {
+		t.Error("key 1 signed twice")
+	}
+}
+
+func TestWalletScan(t *testing.T) {
+	chain := mcmtest.NewChain()
+	client := mcmtest.NewTestNetwork(t, chain, chain, chain).Client(3)
+	tag := []byte("wallet tag..")
+	wallet := mcm.NewWallet([]byte("master seed"), tag)
+	wallet.Client = client
+	chain.SetBalance(wallet.Current(), 10000)
+	destination := mcm.NewWotsKeypair([]byte("destination")).Address()
+	for i := 0; i < 2; i++ {
+		tx, err := wallet.Send(destination, 1000, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mine(chain, tx)
+	}
+
+	// a fresh wallet on the same seed finds the tag at key 2
+	fresh := mcm.NewWallet([]byte("master seed"), tag)
+	fresh.Client = client
+	if err := fresh.Scan(5); err != nil {
+		t.Fatal(err)
+	}
+	if fresh.Index != 2 || !fresh.TagOnChain || !fresh.Signed[0] || !fresh.Signed[1] || fresh.Signed[2] {
+		t.Errorf("scanned wallet: index %d, signed %v, tag on chain %v", fresh.Index, fresh.Signed, fresh.TagOnChain)
+	}
+
+	// an untagged wallet takes the last funded key
+	untagged := mcm.NewWallet([]byte("other seed"), nil)
+	untagged.Client = client
+	chain.SetBalance(untagged.Keypair(3).Address(), 500)
+	if err := untagged.Scan(5); err != nil {
+		t.Fatal(err)
+	}
+	if untagged.Index != 3 || untagged.TagOnChain || !untagged.Signed[2] {
+		t.Errorf("untagged wallet: index %d, signed %v", untagged.Index, untagged.Signed)
+	}
+	empty := mcm.NewWallet([]byte("empty seed"), nil)
+	empty.Client = client
+	if err := empty.Scan(2); err == nil {
+		t.Error("scan of an empty wallet found a key")
+	}
+}
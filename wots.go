@@ -4,6 +4,7 @@ import (
 	"crypto/sha256"
 	"encoding/binary"
 	"encoding/hex"
+	"fmt"
 )
 
 type WotsAddress struct {
@@ -70,6 +71,8 @@ func WotsAddressFromBytes(bytes []byte) WotsAddress {
 	return wots
 }
 
+// WotsAddressFromHex returns the empty address if wots_hex is not a hex
+// address, see ParseWotsAddressHex
 func WotsAddressFromHex(wots_hex string) WotsAddress {
 	bytes, _ := hex.DecodeString(wots_hex)
 	if len(bytes) != TXADDRLEN {
@@ -78,6 +81,18 @@ func WotsAddressFromHex(wots_hex string) WotsAddress {
 	return WotsAddressFromBytes(bytes)
 }
 
+// ParseWotsAddressHex decodes a 2208 bytes address given as hex
+func ParseWotsAddressHex(wots_hex string) (WotsAddress, error) {
+	bytes, err := hex.DecodeString(wots_hex)
+	if err != nil {
+		return WotsAddress{}, fmt.Errorf("%w: %w: %v", ErrInvalidEncoding, ErrInvalidCharacter, err)
+	}
+	if len(bytes) != TXADDRLEN {
+		return WotsAddress{}, fmt.Errorf("%w: %w: %d bytes, expected %d", ErrInvalidEncoding, ErrInvalidLength, len(bytes), TXADDRLEN)
+	}
+	return WotsAddressFromBytes(bytes), nil
+}
+
 // 8792 bytes as input
 func TransactionFromBytes(bytes []byte) Transaction {
 	var tx Transaction
@@ -0,0 +1,221 @@
+package go_mcminterface
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+)
+
+// WOTS+ parameters of Mochimo: sha256, Winternitz parameter 16
+const (
+	WOTS_N    = 32 // hash length
+	WOTS_W    = 16
+	WOTS_LOGW = 4
+	WOTS_LEN1 = 64 // message digits
+	WOTS_LEN2 = 3  // checksum digits
+	WOTS_LEN  = WOTS_LEN1 + WOTS_LEN2
+
+	WOTS_PK_LEN    = WOTS_LEN * WOTS_N // 2144, same as TXSIGLEN
+	WOTS_SIG_LEN   = WOTS_LEN * WOTS_N
+	WOTS_PUB_SEED  = WOTS_PK_LEN          // offset of the public seed in an address
+	WOTS_ADDR_SEED = WOTS_PK_LEN + WOTS_N // offset of the address seed in an address
+)
+
+// hash paddings of the F and PRF functions
+const (
+	hashPaddingF   = 0
+	hashPaddingPRF = 3
+)
+
+// wotsAddr is the hash address of the chains. Mochimo reads it from the
+// address seed as little endian words, and hashes it as big endian words.
+type wotsAddr [8]uint32
+
+func wotsAddrFromBytes(bytes []byte) wotsAddr {
+	var addr wotsAddr
+	for i := range addr {
+		addr[i] = binary.LittleEndian.Uint32(bytes[i*4:])
+	}
+	return addr
+}
+
+func (a *wotsAddr) bytes() []byte {
+	bytes := make([]byte, 32)
+	for i, word := range a {
+		binary.BigEndian.PutUint32(bytes[i*4:], word)
+	}
+	return bytes
+}
+
+func (a *wotsAddr) setChain(chain uint32) { a[5] = chain }
+
+func (a *wotsAddr) setHash(hash uint32) { a[6] = hash }
+
+func (a *wotsAddr) setKeyAndMask(key_and_mask uint32) { a[7] = key_and_mask }
+
+// padding returns the n bytes big endian encoding of value
+func padding(value uint64) []byte {
+	bytes := make([]byte, WOTS_N)
+	binary.BigEndian.PutUint64(bytes[WOTS_N-8:], value)
+	return bytes
+}
+
+// prf hashes the 32 bytes in with key
+func prf(in []byte, key []byte) []byte {
+	buf := append(padding(hashPaddingPRF), key...)
+	buf = append(buf, in...)
+	hash := sha256.Sum256(buf)
+	return hash[:]
+}
+
+// thashF is the chaining function: the input is masked and hashed with a key,
+// both derived from pub_seed and addr
+func thashF(in []byte, pub_seed []byte, addr *wotsAddr) []byte {
+	addr.setKeyAndMask(0)
+	key := prf(addr.bytes(), pub_seed)
+	addr.setKeyAndMask(1)
+	mask := prf(addr.bytes(), pub_seed)
+
+	buf := append(padding(hashPaddingF), key...)
+	for i := 0; i < WOTS_N; i++ {
+		buf = append(buf, in[i]^mask[i])
+	}
+	hash := sha256.Sum256(buf)
+	return hash[:]
+}
+
+// genChain walks a chain from step start for steps steps
+func genChain(in []byte, start int, steps int, pub_seed []byte, addr *wotsAddr) []byte {
+	out := append([]byte{}, in...)
+	for i := start; i < start+steps && i < WOTS_W; i++ {
+		addr.setHash(uint32(i))
+		out = thashF(out, pub_seed, addr)
+	}
+	return out
+}
+
+// baseW splits input in out_len digits of WOTS_LOGW bits
+func baseW(input []byte, out_len int) []int {
+	output := make([]int, out_len)
+	in, bits, total := 0, 0, 0
+	for i := range output {
+		if bits == 0 {
+			total = int(input[in])
+			in++
+			bits += 8
+		}
+		bits -= WOTS_LOGW
+		output[i] = (total >> bits) & (WOTS_W - 1)
+	}
+	return output
+}
+
+// chainLengths returns the digits of msg followed by those of its checksum
+func chainLengths(msg []byte) []int {
+	lengths := baseW(msg, WOTS_LEN1)
+	csum := 0
+	for _, digit := range lengths {
+		csum += WOTS_W - 1 - digit
+	}
+	// the checksum is left aligned on its 2 bytes
+	csum <<= 8 - (WOTS_LEN2*WOTS_LOGW)%8
+	csum_bytes := []byte{byte(csum >> 8), byte(csum)}
+	return append(lengths, baseW(csum_bytes, WOTS_LEN2)...)
+}
+
+// WotsPkFromSig computes the public key a signature of the 32 bytes msg
+// verifies against, given the public seed and the address seed of the
+// signing address. It returns nil if an input has the wrong length.
+func WotsPkFromSig(sig []byte, msg []byte, pub_seed []byte, addr_seed []byte) []byte {
+	if len(sig) != WOTS_SIG_LEN || len(msg) != WOTS_N || len(pub_seed) != WOTS_N || len(addr_seed) != WOTS_N {
+		return nil
+	}
+	addr := wotsAddrFromBytes(addr_seed)
+	pk := make([]byte, 0, WOTS_PK_LEN)
+	for i, length := range chainLengths(msg) {
+		addr.setChain(uint32(i))
+		pk = append(pk, genChain(sig[i*WOTS_N:(i+1)*WOTS_N], length, WOTS_W-1-length, pub_seed, &addr)...)
+	}
+	return pk
+}
+
+// WotsVerify checks that sig is a signature of the 32 bytes msg by address
+func WotsVerify(address WotsAddress, msg []byte, sig []byte) bool {
+	if len(msg) != WOTS_N || len(sig) != WOTS_SIG_LEN {
+		return false
+	}
+	pk := WotsPkFromSig(sig, msg, address.Address[WOTS_PUB_SEED:WOTS_ADDR_SEED], address.Address[WOTS_ADDR_SEED:])
+	return pk != nil && string(pk) == string(address.Address[:WOTS_PK_LEN])
+}
+
+// WotsKeypair is a one-time WOTS+ key. Its address can sign once: any spend
+// moves the balance left to a new change address.
+type WotsKeypair struct {
+	PrivateSeed [WOTS_N]byte // secret
+	PublicSeed  [WOTS_N]byte
+	AddrSeed    [WOTS_N]byte
+}
+
+// NewWotsKeypair derives a keypair from a secret seed, like the Mochimo
+// wallets do: each seed is the sha256 of the secret followed by "seed",
+// "publ" and "addr"
+func NewWotsKeypair(secret []byte) WotsKeypair {
+	var keypair WotsKeypair
+	keypair.PrivateSeed = sha256.Sum256(append(append([]byte{}, secret...), "seed"...))
+	keypair.PublicSeed = sha256.Sum256(append(append([]byte{}, secret...), "publ"...))
+	keypair.AddrSeed = sha256.Sum256(append(append([]byte{}, secret...), "addr"...))
+	return keypair
+}
+
+// GenerateWotsKeypair creates a keypair from a random secret
+func GenerateWotsKeypair() (WotsKeypair, error) {
+	secret := make([]byte, WOTS_N)
+	if _, err := rand.Read(secret); err != nil {
+		return WotsKeypair{}, err
+	}
+	return NewWotsKeypair(secret), nil
+}
+
+// expandSeed derives the secret key of each chain from the private seed
+func (k WotsKeypair) expandSeed() []byte {
+	sk := make([]byte, 0, WOTS_LEN*WOTS_N)
+	for i := 0; i < WOTS_LEN; i++ {
+		sk = append(sk, prf(padding(uint64(i)), k.PrivateSeed[:])...)
+	}
+	return sk
+}
+
+// Address returns the 2208 bytes address of the keypair: public key, public
+// seed and address seed. The last 12 bytes of the address seed are left as
+// the key generation sets them, which is the default tag.
+func (k WotsKeypair) Address() WotsAddress {
+	sk := k.expandSeed()
+	addr := wotsAddrFromBytes(k.AddrSeed[:])
+	var address WotsAddress
+	for i := 0; i < WOTS_LEN; i++ {
+		addr.setChain(uint32(i))
+		copy(address.Address[i*WOTS_N:], genChain(sk[i*WOTS_N:(i+1)*WOTS_N], 0, WOTS_W-1, k.PublicSeed[:], &addr))
+	}
+	copy(address.Address[WOTS_PUB_SEED:], k.PublicSeed[:])
+	// the address words are stored as they are in memory, little endian
+	for i, word := range addr {
+		binary.LittleEndian.PutUint32(address.Address[WOTS_ADDR_SEED+i*4:], word)
+	}
+	return address
+}
+
+// Sign signs the 32 bytes msg. A keypair must never sign two messages.
+func (k WotsKeypair) Sign(msg []byte) ([WOTS_SIG_LEN]byte, error) {
+	var sig [WOTS_SIG_LEN]byte
+	if len(msg) != WOTS_N {
+		return sig, fmt.Errorf("message to sign must be %d bytes, got %d", WOTS_N, len(msg))
+	}
+	sk := k.expandSeed()
+	addr := wotsAddrFromBytes(k.AddrSeed[:])
+	for i, length := range chainLengths(msg) {
+		addr.setChain(uint32(i))
+		copy(sig[i*WOTS_N:], genChain(sk[i*WOTS_N:(i+1)*WOTS_N], 0, length, k.PublicSeed[:], &addr))
+	}
+	return sig, nil
+}
@@ -0,0 +1,133 @@
+package go_mcminterface
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+// Regression vectors of the key generation and signing: digests of the
+// address of NewWotsKeypair(secret) and of its signature of
+// sha256("message "+secret). They were produced by this implementation and
+// only pin its output; vectors from the reference C wots.c are still to be
+// added to check compatibility with Mochimo.
+var wotsVectors = []struct {
+	secret  string
+	pk0     string // first chain of the public key
+	address string // sha256 of the 2208 bytes address
+	sig     string // sha256 of the signature
+}{
+	{
+		secret:  "",
+		pk0:     "a3ab4a384aeae82848c6e0a6f076b98fe9bcff54267f5741104a27da937073c9",
+		address: "46677572d2e8d4ac651ef4a6c610a77f11102ad0aad907bb05514b5aa8052898",
+		sig:     "48a7b20f65e0935e34e08fbddae6198218f59b1dce2751337e48e26015b7f845",
+	},
+	{
+		secret:  "mochimo",
+		pk0:     "1ddd40afac68005ca1e459ce9a554571ab31387c79650c78021dcaa1c1e3e79d",
+		address: "9ea58c03a28172bcf13ff0a91e60fc14cb4750d9578dd10ff355b18f8921f992",
+		sig:     "3ba4e7b3d3aa27b0743d742d2ce9dc552537acc38e2d6d60aeb83dfbf4bc2007",
+	},
+}
+
+func TestWotsRegression(t *testing.T) {
+	for _, v := range wotsVectors {
+		keypair := NewWotsKeypair([]byte(v.secret))
+		address := keypair.Address()
+		if got := hex.EncodeToString(address.Address[:WOTS_N]); got != v.pk0 {
+			t.Errorf("%q: pkgen chain 0 = %s, want %s", v.secret, got, v.pk0)
+		}
+		if got := sha256.Sum256(address.Address[:]); hex.EncodeToString(got[:]) != v.address {
+			t.Errorf("%q: address digest = %x, want %s", v.secret, got, v.address)
+		}
+
+		msg := sha256.Sum256([]byte("message " + v.secret))
+		sig, err := keypair.Sign(msg[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := sha256.Sum256(sig[:]); hex.EncodeToString(got[:]) != v.sig {
+			t.Errorf("%q: signature digest = %x, want %s", v.secret, got, v.sig)
+		}
+		pk := WotsPkFromSig(sig[:], msg[:], keypair.PublicSeed[:], address.Address[WOTS_ADDR_SEED:])
+		if !bytes.Equal(pk, address.Address[:WOTS_PK_LEN]) {
+			t.Errorf("%q: public key from signature differs from pkgen", v.secret)
+		}
+		if !WotsVerify(address, msg[:], sig[:]) {
+			t.Errorf("%q: signature does not verify", v.secret)
+		}
+	}
+}
+
+func TestWotsExpandSeed(t *testing.T) {
+	keypair := NewWotsKeypair([]byte("mochimo"))
+	sk := keypair.expandSeed()
+	// sk_i = sha256(toByte(3, 32) || seed || toByte(i, 32))
+	for _, i := range []int{0, 1, WOTS_LEN - 1} {
+		var buf []byte
+		buf = append(buf, make([]byte, 31)...)
+		buf = append(buf, hashPaddingPRF)
+		buf = append(buf, keypair.PrivateSeed[:]...)
+		buf = append(buf, make([]byte, 31)...)
+		buf = append(buf, byte(i))
+		want := sha256.Sum256(buf)
+		if !bytes.Equal(sk[i*WOTS_N:(i+1)*WOTS_N], want[:]) {
+			t.Errorf("secret key of chain %d differs", i)
+		}
+	}
+}
+
+func TestWotsChainLengths(t *testing.T) {
+	zero := chainLengths(make([]byte, WOTS_N))
+	// checksum 64*15 = 0x3c0, left aligned on 12 bits
+	if got := zero[WOTS_LEN1:]; got[0] != 3 || got[1] != 12 || got[2] != 0 {
+		t.Errorf("checksum digits of a zero message = %v, want [3 12 0]", got)
+	}
+	ones := chainLengths(bytes.Repeat([]byte{0xff}, WOTS_N))
+	for i, digit := range ones {
+		want := WOTS_W - 1
+		if i >= WOTS_LEN1 {
+			want = 0
+		}
+		if digit != want {
+			t.Fatalf("digit %d of a 0xff message = %d, want %d", i, digit, want)
+		}
+	}
+}
+
+func TestWotsVerifyRejects(t *testing.T) {
+	keypair := NewWotsKeypair([]byte("mochimo"))
+	address := keypair.Address()
+	msg := sha256.Sum256([]byte("message"))
+	sig, err := keypair.Sign(msg[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other := msg
+	other[0] ^= 1
+	if WotsVerify(address, other[:], sig[:]) {
+		t.Error("signature verifies another message")
+	}
+	forged := sig
+	forged[100] ^= 1
+	if WotsVerify(address, msg[:], forged[:]) {
+		t.Error("altered signature verifies")
+	}
+}
+
+func TestWotsLengths(t *testing.T) {
+	keypair := NewWotsKeypair([]byte("mochimo"))
+	address := keypair.Address()
+	if _, err := keypair.Sign([]byte{1, 2, 3}); err == nil {
+		t.Error("Sign accepted a 3 bytes message")
+	}
+	if pk := WotsPkFromSig(make([]byte, 10), make([]byte, 3), keypair.PublicSeed[:], keypair.AddrSeed[:]); pk != nil {
+		t.Error("WotsPkFromSig accepted short inputs")
+	}
+	if WotsVerify(address, []byte{1, 2, 3}, make([]byte, WOTS_SIG_LEN)) {
+		t.Error("WotsVerify accepted a 3 bytes message")
+	}
+}